@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/tbirddv/gator/internal/database"
+)
+
+const (
+	// alertCommandTimeout bounds how long an alert command may run before it
+	// is killed, so a hung hook cannot hold up the alerts queued behind it.
+	alertCommandTimeout = 30 * time.Second
+	alertWebhookTimeout = 10 * time.Second
+)
+
+// alertPayload is the post an alert hook receives, as JSON on stdin for a
+// command and as the request body for a webhook. Like the output records,
+// its field names are part of gator's interface.
+type alertPayload struct {
+	RuleID      int64     `json:"rule_id"`
+	User        string    `json:"user"`
+	PostID      int64     `json:"post_id"`
+	Title       string    `json:"title"`
+	URL         string    `json:"url"`
+	Feed        string    `json:"feed"`
+	PublishedAt time.Time `json:"published_at"`
+	Description string    `json:"description"`
+}
+
+// alertQueue delivers alerts in the background so that slow hooks never hold
+// up scraping. Batches of new posts are delivered in the order they were
+// queued, by one worker that runs while there is anything to deliver.
+type alertQueue struct {
+	s       *state
+	mu      sync.Mutex
+	pending []alertBatch
+	running bool
+	done    sync.WaitGroup
+}
+
+type alertBatch struct {
+	postIDs []uuid.UUID
+	log     *slog.Logger
+}
+
+func newAlertQueue(s *state) *alertQueue {
+	return &alertQueue{s: s}
+}
+
+// add queues alerts for posts that have been committed.
+func (q *alertQueue) add(postIDs []uuid.UUID, log *slog.Logger) {
+	if len(postIDs) == 0 {
+		return
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending = append(q.pending, alertBatch{postIDs: postIDs, log: log})
+	if !q.running {
+		q.running = true
+		q.done.Add(1)
+		go q.run()
+	}
+}
+
+func (q *alertQueue) run() {
+	defer q.done.Done()
+	for {
+		q.mu.Lock()
+		if len(q.pending) == 0 {
+			q.running = false
+			q.mu.Unlock()
+			return
+		}
+		batch := q.pending[0]
+		q.pending = q.pending[1:]
+		q.mu.Unlock()
+
+		// The posts are stored either way, so a failed alert is only logged
+		if err := sendAlerts(q.s, batch.postIDs, batch.log); err != nil {
+			batch.log.Warn("failed to send alerts", "error", err)
+		}
+	}
+}
+
+// wait blocks until every queued alert has been delivered, so that commands
+// which scrape can finish their hooks before gator exits.
+func (q *alertQueue) wait() {
+	q.done.Wait()
+}
+
+// sendAlerts runs the hooks of every alert rule that matches one of the
+// newly inserted posts. Each rule alerts at most once per post: a delivery is
+// claimed before its hooks run, so concurrent aggregators never both send it.
+// Hook failures are recorded on the delivery and logged, not returned.
+func sendAlerts(s *state, postIDs []uuid.UUID, log *slog.Logger) error {
+	if len(postIDs) == 0 {
+		return nil
+	}
+	matches, err := s.queries.GetAlertMatches(context.Background(), postIDs)
+	if err != nil {
+		return fmt.Errorf("failed to match alert rules: %w", err)
+	}
+	for _, match := range matches {
+		claimParams := database.ClaimAlertDeliveryParams{
+			RuleID:      match.RuleID,
+			PostID:      match.PostID,
+			DeliveredAt: time.Now(),
+		}
+		claimed, err := s.queries.ClaimAlertDelivery(context.Background(), claimParams)
+		if err != nil {
+			return fmt.Errorf("failed to claim alert delivery: %w", err)
+		}
+		if claimed == 0 {
+			// Another aggregator already sent it
+			continue
+		}
+
+		log := log.With("rule_id", match.RuleID, "post_id", match.ShortID)
+		if err := deliverAlert(match); err != nil {
+			s.metrics.alerts.Inc("failed")
+			log.Warn("alert failed", "error", err)
+			errorParams := database.SetAlertDeliveryErrorParams{
+				RuleID: match.RuleID,
+				PostID: match.PostID,
+				Error:  sql.NullString{String: err.Error(), Valid: true},
+			}
+			if err := s.queries.SetAlertDeliveryError(context.Background(), errorParams); err != nil {
+				log.Warn("failed to record alert error", "error", err)
+			}
+			continue
+		}
+		s.metrics.alerts.Inc("sent")
+		log.Info("alert sent", "title", match.Title)
+	}
+	return nil
+}
+
+// deliverAlert runs the rule's command and posts to its webhook, whichever
+// are configured, and reports every hook that failed.
+func deliverAlert(match database.GetAlertMatchesRow) error {
+	payload, err := json.Marshal(alertPayload{
+		RuleID:      match.RuleID,
+		User:        match.UserName,
+		PostID:      match.ShortID,
+		Title:       match.Title,
+		URL:         match.Url,
+		Feed:        match.FeedName,
+		PublishedAt: match.PublishedAt,
+		Description: match.Description.String,
+	})
+	if err != nil {
+		return err
+	}
+	var errs []error
+	if match.Command.Valid {
+		if err := runAlertCommand(match.Command.String, payload); err != nil {
+			errs = append(errs, fmt.Errorf("command: %w", err))
+		}
+	}
+	if match.WebhookUrl.Valid {
+		if err := postAlertWebhook(match.WebhookUrl.String, payload); err != nil {
+			errs = append(errs, fmt.Errorf("webhook: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// runAlertCommand runs command through the shell with payload on stdin.
+func runAlertCommand(command string, payload []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), alertCommandTimeout)
+	defer cancel()
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Stdin = bytes.NewReader(payload)
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return fmt.Errorf("timed out after %s", alertCommandTimeout)
+	}
+	if err != nil {
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return fmt.Errorf("%w: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+func postAlertWebhook(url string, payload []byte) error {
+	client := &http.Client{Timeout: alertWebhookTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
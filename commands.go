@@ -1,7 +1,10 @@
 package main
 
 type Command struct {
-	Name        string
+	Name string
+	// Activity marks commands that count as the current user reading, which
+	// makes the feeds they follow fetched more often.
+	Activity    bool
 	Description string
 	Execute     func() error
 }
@@ -51,14 +54,39 @@ func CommandInit(state *state) map[string]Command {
 
 	commands["agg"] = Command{
 		Name:        "agg",
-		Description: "Aggregate RSS feeds, Usage: agg <time_between_requests>",
+		Description: "Aggregate RSS feeds, Usage: agg <time_between_requests> [--daemon] [--singleton] [--digest daily|weekly|<duration>] [--prune <interval>] | agg --once [--digest daily|weekly|<duration>] [--prune <interval>]",
 		Execute: func() error {
 			return HandleAgg(state)
 		},
 	}
 
+	commands["aggctl"] = Command{
+		Name:        "aggctl",
+		Description: "Control a running agg --daemon. Usage: aggctl <status|pause|resume|refresh <feed_url|feed_name>>",
+		Execute: func() error {
+			return HandleAggCtl(state)
+		},
+	}
+
+	commands["refresh"] = Command{
+		Name:        "refresh",
+		Description: "Fetch feeds immediately regardless of schedule. Usage: refresh <feed_url|feed_name> | refresh --all [--followed]",
+		Execute: func() error {
+			return HandleRefresh(state)
+		},
+	}
+
+	commands["history"] = Command{
+		Name:        "history",
+		Description: "Show recent fetch attempts for a feed. Usage: history <feed_url|feed_name> [--limit n]",
+		Execute: func() error {
+			return HandleHistory(state)
+		},
+	}
+
 	commands["addfeed"] = Command{
 		Name:        "addfeed",
+		Activity:    true,
 		Description: "Add a new RSS feed",
 		Execute: func() error {
 			return HandleCreateFeed(state)
@@ -75,6 +103,7 @@ func CommandInit(state *state) map[string]Command {
 
 	commands["follow"] = Command{
 		Name:        "follow",
+		Activity:    true,
 		Description: "Follow an RSS feed",
 		Execute: func() error {
 			return HandleFollow(state)
@@ -83,7 +112,8 @@ func CommandInit(state *state) map[string]Command {
 
 	commands["following"] = Command{
 		Name:        "following",
-		Description: "List all RSS feeds followed by the current user",
+		Activity:    true,
+		Description: "List all RSS feeds followed by the current user with unread counts. Usage: following [--count-muted]",
 		Execute: func() error {
 			return HandleGetFollows(state)
 		},
@@ -91,6 +121,7 @@ func CommandInit(state *state) map[string]Command {
 
 	commands["unfollow"] = Command{
 		Name:        "unfollow",
+		Activity:    true,
 		Description: "Unfollow an RSS feed for the current user",
 		Execute: func() error {
 			return HandleUnfollow(state)
@@ -99,11 +130,189 @@ func CommandInit(state *state) map[string]Command {
 
 	commands["browse"] = Command{
 		Name:        "browse",
-		Description: "Browse posts from Current User's followed feeds. Usage: browse [Number of Posts to Browse]",
+		Activity:    true,
+		Description: "Browse posts from Current User's followed feeds. Usage: browse [Number of Posts to Browse] [--all] [--updated] [--before <cursor> | --after <cursor>] [--offset n] [--feed <name|url>...] [--since <date|7d>] [--until <date|7d>] [--match <text>...] [--tag <tag>...] [--muted] [--count-muted] [--duplicates]",
 		Execute: func() error {
 			return HandleBrowse(state)
 		},
 	}
 
+	commands["mark-read"] = Command{
+		Name:        "mark-read",
+		Activity:    true,
+		Description: "Mark posts as read. Usage: mark-read <post_id|post_url> | mark-read --feed <feed_url|feed_name> | mark-read --before <date>",
+		Execute: func() error {
+			return HandleMarkRead(state)
+		},
+	}
+
+	commands["mark-unread"] = Command{
+		Name:        "mark-unread",
+		Activity:    true,
+		Description: "Mark a post as unread. Usage: mark-unread <post_id|post_url>",
+		Execute: func() error {
+			return HandleMarkUnread(state)
+		},
+	}
+
+	commands["diff"] = Command{
+		Name:        "diff",
+		Activity:    true,
+		Description: "Show how a post changed between fetches. Usage: diff <post_id|post_url>",
+		Execute: func() error {
+			return HandleDiff(state)
+		},
+	}
+
+	commands["search"] = Command{
+		Name:        "search",
+		Activity:    true,
+		Description: "Search posts in followed feeds. Usage: search <query> [--all] [--limit n] [--muted] [--count-muted]",
+		Execute: func() error {
+			return HandleSearch(state)
+		},
+	}
+
+	commands["star"] = Command{
+		Name:        "star",
+		Activity:    true,
+		Description: "Save a post to your starred posts. Usage: star <post_id|post_url>",
+		Execute: func() error {
+			return HandleStar(state)
+		},
+	}
+
+	commands["unstar"] = Command{
+		Name:        "unstar",
+		Activity:    true,
+		Description: "Remove a post from your starred posts. Usage: unstar <post_id|post_url>",
+		Execute: func() error {
+			return HandleUnstar(state)
+		},
+	}
+
+	commands["starred"] = Command{
+		Name:        "starred",
+		Activity:    true,
+		Description: "List your starred posts. Usage: starred [Number of Posts]",
+		Execute: func() error {
+			return HandleStarred(state)
+		},
+	}
+
+	commands["open"] = Command{
+		Name:        "open",
+		Activity:    true,
+		Description: "Open a post in your browser and mark it read. Usage: open <post_id|post_url>",
+		Execute: func() error {
+			return HandleOpen(state)
+		},
+	}
+
+	commands["read"] = Command{
+		Name:        "read",
+		Activity:    true,
+		Description: "Read a post in your pager and mark it read. Usage: read <post_id|post_url>",
+		Execute: func() error {
+			return HandleRead(state)
+		},
+	}
+
+	commands["tag"] = Command{
+		Name:        "tag",
+		Activity:    true,
+		Description: "Tag a post, or every post matching a search. Usage: tag <post_id|post_url> <tag>... | tag --search <query> [--all] <tag>...",
+		Execute: func() error {
+			return HandleTag(state)
+		},
+	}
+
+	commands["untag"] = Command{
+		Name:        "untag",
+		Activity:    true,
+		Description: "Remove tags from a post. Usage: untag <post_id|post_url> <tag>...",
+		Execute: func() error {
+			return HandleUntag(state)
+		},
+	}
+
+	commands["tags"] = Command{
+		Name:        "tags",
+		Activity:    true,
+		Description: "List your tags with how many posts carry each. Usage: tags",
+		Execute: func() error {
+			return HandleTags(state)
+		},
+	}
+
+	commands["mute"] = Command{
+		Name:        "mute",
+		Activity:    true,
+		Description: "Hide posts matching a rule from browse, search and unread counts. Usage: mute add [--feed <feed_url|feed_name>] <keyword|regex|author|category> <pattern> | mute list | mute remove <rule_id>",
+		Execute: func() error {
+			return HandleMute(state)
+		},
+	}
+
+	commands["alert"] = Command{
+		Name:        "alert",
+		Activity:    true,
+		Description: "Run a command or call a webhook when a new post matches a rule. Usage: alert add [--feed <feed_url|feed_name>] [--command <shell command>] [--webhook <url>] <keyword|regex> <pattern> | alert list | alert remove <alert_id>",
+		Execute: func() error {
+			return HandleAlert(state)
+		},
+	}
+
+	commands["email"] = Command{
+		Name:        "email",
+		Activity:    true,
+		Description: "Show or set the current user's email address for digests. Usage: email [<address> | --clear]",
+		Execute: func() error {
+			return HandleEmail(state)
+		},
+	}
+
+	commands["digest"] = Command{
+		Name:        "digest",
+		Activity:    true,
+		Description: "Show, email or save a digest of new posts since the last digest. Usage: digest [--send] [--file <path>] [--since <date|7d>] [--limit n]",
+		Execute: func() error {
+			return HandleDigest(state)
+		},
+	}
+
+	commands["serve"] = Command{
+		Name:        "serve",
+		Description: "Serve each user's timeline, starred posts and tags as RSS, Atom and JSON feeds. Usage: serve [--listen localhost:8081] [--base-url <url>] [--limit n]",
+		Execute: func() error {
+			return HandleServe(state)
+		},
+	}
+
+	commands["retention"] = Command{
+		Name:        "retention",
+		Description: "Show the retention policy, or override it for a feed. Usage: retention | retention <feed_url|feed_name> [--max-age <90d|0|default>] [--max-posts <n|0|default>]",
+		Execute: func() error {
+			return HandleRetention(state)
+		},
+	}
+
+	commands["prune"] = Command{
+		Name:        "prune",
+		Description: "Delete posts expired by the retention policy, except starred and tagged posts. Usage: prune [--dry-run] [--batch-size n]",
+		Execute: func() error {
+			return HandlePrune(state)
+		},
+	}
+
+	commands["tui"] = Command{
+		Name:        "tui",
+		Activity:    true,
+		Description: "Read followed feeds in a full-screen terminal interface. Usage: tui",
+		Execute: func() error {
+			return HandleTUI(state)
+		},
+	}
+
 	return commands
 }
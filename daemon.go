@@ -0,0 +1,371 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/tbirddv/gator/internal/database"
+)
+
+//go:embed sql/schema/*.sql
+var schemaFS embed.FS
+
+// daemonShutdownTimeout bounds how long the daemon waits on shutdown, and is
+// long enough for a scrape already fetching a feed to finish.
+const daemonShutdownTimeout = 15 * time.Second
+
+// aggregator runs scrapeFeeds on a ticker for agg --daemon, and lets the
+// control API pause it, trigger refreshes and inspect what it is doing.
+type aggregator struct {
+	s        *state
+	interval time.Duration
+	refresh  chan database.Feed
+	leader   *leaderLock // nil unless running with --singleton
+	retry    time.Duration
+
+	mu           sync.Mutex
+	standby      bool
+	paused       bool
+	current      string
+	currentSince time.Time
+	lastScrape   time.Time
+	lastError    string
+}
+
+// aggregatorStatus is the control API's report of worker activity.
+type aggregatorStatus struct {
+	Paused       bool       `json:"paused"`
+	Standby      bool       `json:"standby"`
+	Interval     string     `json:"interval"`
+	CurrentFeed  string     `json:"current_feed,omitempty"`
+	CurrentSince *time.Time `json:"current_since,omitempty"`
+	LastScrape   *time.Time `json:"last_scrape,omitempty"`
+	LastError    string     `json:"last_error,omitempty"`
+}
+
+func newAggregator(s *state, interval time.Duration, leader *leaderLock, retry time.Duration) *aggregator {
+	return &aggregator{
+		s:        s,
+		interval: interval,
+		refresh:  make(chan database.Feed, 16),
+		leader:   leader,
+		retry:    retry,
+	}
+}
+
+// run scrapes until ctx is cancelled, and returns nil then. Scrape errors are
+// logged rather than returned so a single bad feed cannot stop the service;
+// it only returns an error if it can no longer scrape at all.
+func (a *aggregator) run(ctx context.Context) error {
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+	if err := a.lead(ctx); err != nil {
+		return err
+	}
+	a.scrapeNext()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case feed := <-a.refresh:
+			if err := a.lead(ctx); err != nil {
+				return err
+			}
+			a.scrape(feed.Url, func() error {
+				_, err := scrapeFeed(a.s, feed)
+				return err
+			})
+		case <-ticker.C:
+			if err := a.lead(ctx); err != nil {
+				return err
+			}
+			a.scrapeNext()
+		}
+	}
+}
+
+// lead makes sure this aggregator holds leadership when running as a
+// singleton, waiting as a standby if it does not. Being cancelled while
+// waiting is not an error.
+func (a *aggregator) lead(ctx context.Context) error {
+	if a.leader == nil || a.leader.held(ctx) {
+		return nil
+	}
+	a.mu.Lock()
+	a.standby = true
+	a.mu.Unlock()
+	if err := a.leader.wait(ctx, a.s, a.retry); err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("failed to take aggregator leadership: %w", err)
+	}
+	a.mu.Lock()
+	a.standby = false
+	a.mu.Unlock()
+	return nil
+}
+
+func (a *aggregator) scrapeNext() {
+	a.mu.Lock()
+	paused := a.paused
+	a.mu.Unlock()
+	if paused {
+		return
+	}
+	a.scrape("next due feed", func() error { return scrapeFeeds(a.s) })
+	sendDueDigests(a.s)
+	pruneIfDue(a.s)
+}
+
+func (a *aggregator) scrape(what string, fn func() error) {
+	a.mu.Lock()
+	a.current = what
+	a.currentSince = time.Now()
+	a.mu.Unlock()
+
+	err := fn()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.current = ""
+	a.lastScrape = time.Now()
+	a.lastError = ""
+	if err != nil {
+		a.lastError = err.Error()
+		a.s.logger.Error("error scraping feeds", "error", err)
+	}
+}
+
+func (a *aggregator) setPaused(paused bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.paused = paused
+	a.s.logger.Info("aggregator state changed", "paused", paused)
+}
+
+func (a *aggregator) status() aggregatorStatus {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	status := aggregatorStatus{
+		Paused:      a.paused,
+		Standby:     a.standby,
+		Interval:    a.interval.String(),
+		CurrentFeed: a.current,
+		LastError:   a.lastError,
+	}
+	if a.current != "" {
+		since := a.currentSince
+		status.CurrentSince = &since
+	}
+	if !a.lastScrape.IsZero() {
+		last := a.lastScrape
+		status.LastScrape = &last
+	}
+	return status
+}
+
+// runDaemon runs the aggregator as a service until interrupted, serving
+// health checks (and metrics) on listenAddr and the control API on socketPath.
+func runDaemon(s *state, interval time.Duration, listenAddr, socketPath string, leader *leaderLock, standbyRetry time.Duration) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	agg := newAggregator(s, interval, leader, standbyRetry)
+
+	health := http.NewServeMux()
+	health.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	health.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		if err := checkReady(r.Context(), s); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ready")
+	})
+	health.Handle("GET /metrics", s.metrics.registry.Handler())
+	healthServer := &http.Server{Addr: listenAddr, Handler: health}
+
+	// A socket left behind by a crashed daemon would make Listen fail, but one
+	// that still answers belongs to a running daemon and must be left alone
+	if conn, err := net.DialTimeout("unix", socketPath, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("another aggregator is already listening on %s", socketPath)
+	}
+	if err := os.Remove(socketPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove stale control socket: %w", err)
+	}
+	controlListener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on control socket: %w", err)
+	}
+	defer os.Remove(socketPath)
+	if err := os.Chmod(socketPath, 0o600); err != nil {
+		controlListener.Close()
+		return fmt.Errorf("failed to restrict control socket: %w", err)
+	}
+	controlServer := &http.Server{Handler: controlHandler(s, agg)}
+
+	errs := make(chan error, 3)
+	go func() {
+		s.logger.Info("serving health checks", "addr", listenAddr)
+		if err := healthServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			errs <- fmt.Errorf("health server failed: %w", err)
+		}
+	}()
+	go func() {
+		s.logger.Info("serving control API", "socket", socketPath)
+		if err := controlServer.Serve(controlListener); !errors.Is(err, http.ErrServerClosed) {
+			errs <- fmt.Errorf("control server failed: %w", err)
+		}
+	}()
+	// The daemon is only healthy while it scrapes, so it stops if the
+	// aggregator does
+	aggDone := make(chan struct{})
+	go func() {
+		defer close(aggDone)
+		if err := agg.run(ctx); err != nil {
+			errs <- fmt.Errorf("aggregator stopped: %w", err)
+		}
+	}()
+
+	var serveErr error
+	select {
+	case <-ctx.Done():
+		s.logger.Info("shutting down aggregator")
+	case serveErr = <-errs:
+	}
+	cancel()
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), daemonShutdownTimeout)
+	defer cancelShutdown()
+	healthServer.Shutdown(shutdownCtx)
+	controlServer.Shutdown(shutdownCtx)
+	// Let a scrape in progress commit before the database is closed
+	select {
+	case <-aggDone:
+	case <-shutdownCtx.Done():
+		s.logger.Warn("aggregator did not stop before the shutdown timeout", "timeout", daemonShutdownTimeout)
+	}
+	return serveErr
+}
+
+func controlHandler(s *state, agg *aggregator) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(agg.status())
+	})
+	mux.HandleFunc("POST /pause", func(w http.ResponseWriter, r *http.Request) {
+		agg.setPaused(true)
+		fmt.Fprintln(w, "paused")
+	})
+	mux.HandleFunc("POST /resume", func(w http.ResponseWriter, r *http.Request) {
+		agg.setPaused(false)
+		fmt.Fprintln(w, "resumed")
+	})
+	mux.HandleFunc("POST /refresh", func(w http.ResponseWriter, r *http.Request) {
+		ref := r.URL.Query().Get("feed")
+		if ref == "" {
+			http.Error(w, "feed URL or name is required", http.StatusBadRequest)
+			return
+		}
+		feed, err := resolveFeed(s, ref)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		select {
+		case agg.refresh <- feed:
+			w.WriteHeader(http.StatusAccepted)
+			fmt.Fprintf(w, "refresh of %s queued\n", feed.Url)
+		default:
+			http.Error(w, "too many refreshes queued", http.StatusServiceUnavailable)
+		}
+	})
+	return mux
+}
+
+// checkReady reports whether the database is reachable and has every
+// migration in sql/schema applied.
+func checkReady(ctx context.Context, s *state) error {
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("database unreachable: %w", err)
+	}
+	want, err := latestSchemaVersion()
+	if err != nil {
+		return err
+	}
+	// goose records ups and downs, so a version counts only if its latest row applied it
+	var have int64
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(MAX(version_id), 0) FROM (
+			SELECT DISTINCT ON (version_id) version_id, is_applied
+			FROM goose_db_version
+			ORDER BY version_id, id DESC
+		) versions
+		WHERE is_applied`).Scan(&have)
+	if err != nil {
+		return fmt.Errorf("failed to read migration version: %w", err)
+	}
+	if have < want {
+		return fmt.Errorf("database schema is at version %d, expected %d", have, want)
+	}
+	return nil
+}
+
+func latestSchemaVersion() (int64, error) {
+	files, err := fs.Glob(schemaFS, "sql/schema/*.sql")
+	if err != nil {
+		return 0, err
+	}
+	var latest int64
+	for _, file := range files {
+		prefix, _, _ := strings.Cut(filepath.Base(file), "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid migration file name %s", file)
+		}
+		latest = max(latest, version)
+	}
+	return latest, nil
+}
+
+// defaultControlSocket is where agg --daemon and aggctl meet unless told otherwise.
+func defaultControlSocket() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "gator-agg.sock")
+}
+
+// controlClient talks HTTP to the daemon over its Unix socket.
+func controlClient(socketPath string) *http.Client {
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socketPath)
+			},
+		},
+	}
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/tbirddv/gator/internal/config"
+	"github.com/tbirddv/gator/internal/database"
+)
+
+const (
+	// defaultDigestFeedLimit is how many posts a digest lists from each feed;
+	// the rest are only counted, so a busy feed cannot crowd out the others.
+	defaultDigestFeedLimit = 20
+	// firstDigestWindow is how far back a user's first digest reaches when
+	// it is not sent on a schedule.
+	firstDigestWindow = 24 * time.Hour
+	digestSummaryLen  = 280
+)
+
+// digest is the posts that arrived in a user's followed feeds between two
+// times, grouped by feed.
+type digest struct {
+	User  string
+	Since time.Time
+	Until time.Time
+	Feeds []digestFeed
+	Posts int // posts that arrived, including those not listed
+}
+
+type digestFeed struct {
+	Name  string
+	URL   string
+	Total int // posts that arrived in the feed
+	Posts []digestPost
+}
+
+// More is how many of the feed's new posts the digest does not list.
+func (f digestFeed) More() int {
+	return f.Total - len(f.Posts)
+}
+
+type digestPost struct {
+	PostID      int64
+	Title       string
+	URL         string
+	PublishedAt time.Time
+	Summary     string
+}
+
+// buildDigest collects the posts stored for the user's followed feeds after
+// since and up to until, leaving out muted posts. It lists the newest
+// postsPerFeed posts of each feed and counts the rest.
+func buildDigest(s *state, user database.User, since, until time.Time, postsPerFeed int32) (digest, error) {
+	d := digest{User: user.Name, Since: since, Until: until}
+	postsParams := database.GetDigestPostsParams{
+		UserID:       user.ID,
+		Since:        since,
+		Until:        until,
+		PostsPerFeed: postsPerFeed,
+	}
+	posts, err := s.queries.GetDigestPosts(context.Background(), postsParams)
+	if err != nil {
+		return d, fmt.Errorf("failed to get posts for digest: %w", err)
+	}
+	for _, post := range posts {
+		if len(d.Feeds) == 0 || d.Feeds[len(d.Feeds)-1].URL != post.FeedUrl {
+			d.Feeds = append(d.Feeds, digestFeed{Name: post.FeedName, URL: post.FeedUrl, Total: int(post.FeedPosts)})
+			d.Posts += int(post.FeedPosts)
+		}
+		feed := &d.Feeds[len(d.Feeds)-1]
+		feed.Posts = append(feed.Posts, digestPost{
+			PostID:      post.ShortID,
+			Title:       post.Title,
+			URL:         post.Url,
+			PublishedAt: post.PublishedAt,
+			Summary:     summarize(plainText(post.Description.String), digestSummaryLen),
+		})
+	}
+	return d, nil
+}
+
+// summarize shortens text to at most n runes, breaking between words.
+func summarize(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= n {
+		return text
+	}
+	cut := string(runes[:n])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return cut + "…"
+}
+
+func (d digest) Subject() string {
+	if d.Posts == 0 {
+		return "gator digest: no new posts"
+	}
+	return fmt.Sprintf("gator digest: %d new %s in %d %s", d.Posts, plural(d.Posts, "post"), len(d.Feeds), plural(len(d.Feeds), "feed"))
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	return word + "s"
+}
+
+const digestTimeFormat = "Mon Jan 2 2006 15:04"
+
+// Text renders the digest as plain text wrapped for email.
+func (d digest) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "New posts for %s from %s to %s\n", d.User, d.Since.Local().Format(digestTimeFormat), d.Until.Local().Format(digestTimeFormat))
+	if d.Posts == 0 {
+		b.WriteString("\nNo new posts.\n")
+	}
+	for _, feed := range d.Feeds {
+		fmt.Fprintf(&b, "\n== %s (%d) ==\n", feed.Name, feed.Total)
+		for _, post := range feed.Posts {
+			fmt.Fprintf(&b, "\n#%d %s\n", post.PostID, post.Title)
+			fmt.Fprintf(&b, "%s - %s\n", post.PublishedAt.Local().Format(digestTimeFormat), post.URL)
+			if post.Summary != "" {
+				for _, line := range wrapText(post.Summary, 72) {
+					fmt.Fprintf(&b, "    %s\n", line)
+				}
+			}
+		}
+		if more := feed.More(); more > 0 {
+			fmt.Fprintf(&b, "\n...and %d more %s; run gator browse for the rest.\n", more, plural(more, "post"))
+		}
+	}
+	return b.String()
+}
+
+var digestHTML = template.Must(template.New("digest").Funcs(template.FuncMap{
+	"date": func(t time.Time) string { return t.Local().Format(digestTimeFormat) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Subject}}</title></head>
+<body style="font-family: sans-serif; max-width: 40em;">
+<h1 style="font-size: 1.3em;">New posts for {{.User}}</h1>
+<p style="color: #666;">{{date .Since}} to {{date .Until}}</p>
+{{- if eq .Posts 0}}
+<p>No new posts.</p>
+{{- end}}
+{{- range .Feeds}}
+<h2 style="font-size: 1.1em; border-bottom: 1px solid #ccc;"><a href="{{.URL}}">{{.Name}}</a> ({{.Total}})</h2>
+{{- range .Posts}}
+<p><a href="{{.URL}}"><strong>{{.Title}}</strong></a><br>
+<small style="color: #666;">#{{.PostID}} &middot; {{date .PublishedAt}}</small>
+{{- if .Summary}}<br>{{.Summary}}{{end}}</p>
+{{- end}}
+{{- with .More}}
+<p><em>...and {{.}} more; run gator browse for the rest.</em></p>
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
+
+// HTML renders the digest as a standalone HTML page.
+func (d digest) HTML() (string, error) {
+	var b strings.Builder
+	if err := digestHTML.Execute(&b, d); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// mailDigest sends the digest to one address through the configured SMTP
+// server, as a multipart message with both text and HTML versions.
+func mailDigest(cfg *config.Config, to string, d digest) error {
+	addr := cfg.SMTPAddr()
+	if addr == "" {
+		return errors.New("no SMTP server is configured, set smtp_host in ~/.gatorconfig.json")
+	}
+	if cfg.SMTPFrom == "" {
+		return errors.New("no sender address is configured, set smtp_from in ~/.gatorconfig.json")
+	}
+	from, err := mail.ParseAddress(cfg.SMTPFrom)
+	if err != nil {
+		return fmt.Errorf("invalid smtp_from: %w", err)
+	}
+	msg, err := digestMessage(cfg.SMTPFrom, to, d, time.Now())
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if cfg.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost)
+	}
+	if err := smtp.SendMail(addr, auth, from.Address, []string{to}, msg); err != nil {
+		return fmt.Errorf("failed to send digest to %s: %w", to, err)
+	}
+	return nil
+}
+
+func digestMessage(from, to string, d digest, date time.Time) ([]byte, error) {
+	html, err := d.HTML()
+	if err != nil {
+		return nil, err
+	}
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	// Clients show the last alternative they can display, so HTML goes last
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", d.Text()},
+		{"text/html; charset=utf-8", html},
+	} {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qw := quotedprintable.NewWriter(pw)
+		if _, err := qw.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qw.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	for _, header := range [][2]string{
+		{"From", from},
+		{"To", to},
+		{"Subject", mime.QEncoding.Encode("utf-8", d.Subject())},
+		{"Date", date.Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "multipart/alternative; boundary=" + mw.Boundary()},
+	} {
+		fmt.Fprintf(&msg, "%s: %s\r\n", header[0], header[1])
+	}
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+	return msg.Bytes(), nil
+}
+
+// parseDigestInterval accepts daily, weekly or a duration such as 12h.
+func parseDigestInterval(value string) (time.Duration, error) {
+	switch value {
+	case "daily":
+		return 24 * time.Hour, nil
+	case "weekly":
+		return 7 * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid digest interval %s, use daily, weekly or a duration such as 12h", value)
+	}
+	return d, nil
+}
+
+// sendDueDigests emails a digest to every user with an email address whose
+// last one is at least the digest interval old. Each digest is claimed
+// before it is sent, so concurrent aggregators never send it twice, and
+// released again if sending fails so the next run retries it.
+func sendDueDigests(s *state) {
+	interval := s.schedule.digestInterval
+	if interval <= 0 {
+		return
+	}
+	now := time.Now().Truncate(time.Microsecond)
+	users, err := s.queries.GetUsersDueForDigest(context.Background(), NewNullTime(now.Add(-interval)))
+	if err != nil {
+		s.logger.Error("failed to get users due a digest", "error", err)
+		return
+	}
+	for _, user := range users {
+		log := s.logger.With("user", user.Name)
+		claimParams := database.SwapLastDigestAtParams{
+			ID:           user.ID,
+			LastDigestAt: NewNullTime(now),
+			Previous:     user.LastDigestAt,
+		}
+		claimed, err := s.queries.SwapLastDigestAt(context.Background(), claimParams)
+		if err != nil {
+			log.Error("failed to claim digest", "error", err)
+			continue
+		}
+		if claimed == 0 {
+			// Another aggregator is sending it
+			continue
+		}
+
+		since := now.Add(-interval)
+		if user.LastDigestAt.Valid {
+			since = user.LastDigestAt.Time
+		}
+		d, err := buildDigest(s, user, since, now, defaultDigestFeedLimit)
+		if err == nil && d.Posts > 0 {
+			err = mailDigest(s.config, user.Email.String, d)
+		}
+		if err != nil {
+			s.metrics.digests.Inc("failed")
+			log.Warn("failed to send digest", "error", err)
+			releaseParams := database.SwapLastDigestAtParams{
+				ID:           user.ID,
+				LastDigestAt: user.LastDigestAt,
+				Previous:     NewNullTime(now),
+			}
+			if _, err := s.queries.SwapLastDigestAt(context.Background(), releaseParams); err != nil {
+				log.Error("failed to release digest", "error", err)
+			}
+			continue
+		}
+		if d.Posts == 0 {
+			log.Debug("no new posts for digest")
+			continue
+		}
+		s.metrics.digests.Inc("sent")
+		log.Info("sent digest", "to", user.Email.String, "posts", d.Posts)
+	}
+}
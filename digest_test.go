@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tbirddv/gator/internal/config"
+)
+
+// smtpMessage is one message received by fakeSMTP.
+type smtpMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+// fakeSMTP accepts one SMTP session on a local port and sends the message it
+// receives on the returned channel.
+func fakeSMTP(t *testing.T) (host string, port int, messages <-chan smtpMessage) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	received := make(chan smtpMessage, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(10 * time.Second))
+		r := bufio.NewReader(conn)
+		reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+		reply("220 localhost ESMTP fake")
+		var msg smtpMessage
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			verb := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+			switch verb {
+			case "EHLO", "HELO":
+				reply("250 localhost")
+			case "MAIL":
+				msg.from = strings.TrimPrefix(line, "MAIL FROM:")
+				reply("250 OK")
+			case "RCPT":
+				msg.to = append(msg.to, strings.TrimPrefix(line, "RCPT TO:"))
+				reply("250 OK")
+			case "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				var data strings.Builder
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(strings.TrimPrefix(line, "."))
+				}
+				msg.data = data.String()
+				reply("250 OK")
+				received <- msg
+			case "QUIT":
+				reply("221 Bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+	addr := ln.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, received
+}
+
+func testDigest() digest {
+	published := time.Date(2026, 3, 4, 9, 30, 0, 0, time.UTC)
+	return digest{
+		User:  "alice",
+		Since: published.Add(-24 * time.Hour),
+		Until: published.Add(time.Hour),
+		Posts: 3,
+		Feeds: []digestFeed{{
+			Name:  "Go Blog",
+			URL:   "https://go.dev/blog/feed.atom",
+			Total: 3,
+			Posts: []digestPost{{
+				PostID:      42,
+				Title:       "Generics & <iterators>",
+				URL:         "https://go.dev/blog/iter",
+				PublishedAt: published,
+				Summary:     "Range over functions, explained — with examples.",
+			}},
+		}},
+	}
+}
+
+func TestMailDigest(t *testing.T) {
+	host, port, messages := fakeSMTP(t)
+	cfg := &config.Config{
+		SMTPHost: host,
+		SMTPPort: port,
+		SMTPFrom: "Gator <gator@example.com>",
+	}
+	d := testDigest()
+	if err := mailDigest(cfg, "alice@example.com", d); err != nil {
+		t.Fatalf("mailDigest failed: %v", err)
+	}
+
+	var msg smtpMessage
+	select {
+	case msg = <-messages:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+	}
+	if msg.from != "<gator@example.com>" {
+		t.Errorf("MAIL FROM = %q, want <gator@example.com>", msg.from)
+	}
+	if len(msg.to) != 1 || msg.to[0] != "<alice@example.com>" {
+		t.Errorf("RCPT TO = %q, want [<alice@example.com>]", msg.to)
+	}
+
+	parsed, err := mail.ReadMessage(strings.NewReader(msg.data))
+	if err != nil {
+		t.Fatalf("failed to parse message: %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(parsed.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("failed to decode subject: %v", err)
+	}
+	if want := "gator digest: 3 new posts in 1 feed"; subject != want {
+		t.Errorf("Subject = %q, want %q", subject, want)
+	}
+	if got := parsed.Header.Get("To"); got != "alice@example.com" {
+		t.Errorf("To = %q, want alice@example.com", got)
+	}
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("failed to parse content type: %v", err)
+	}
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %s, want multipart/alternative", mediaType)
+	}
+
+	parts := map[string]string{}
+	var order []string
+	mr := multipart.NewReader(parsed.Body, params["boundary"])
+	for {
+		part, err := mr.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read part: %v", err)
+		}
+		if got := part.Header.Get("Content-Transfer-Encoding"); got != "quoted-printable" {
+			t.Errorf("Content-Transfer-Encoding = %q, want quoted-printable", got)
+		}
+		body, err := io.ReadAll(quotedprintable.NewReader(part))
+		if err != nil {
+			t.Fatalf("failed to decode part: %v", err)
+		}
+		contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+		parts[contentType] = string(body)
+		order = append(order, contentType)
+	}
+	if strings.Join(order, ",") != "text/plain,text/html" {
+		t.Fatalf("parts = %v, want text/plain then text/html", order)
+	}
+
+	text := parts["text/plain"]
+	for _, want := range []string{
+		"New posts for alice",
+		"== Go Blog (3) ==",
+		"#42 Generics & <iterators>",
+		"https://go.dev/blog/iter",
+		"Range over functions, explained — with examples.",
+		"...and 2 more posts; run gator browse for the rest.",
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text part is missing %q:\n%s", want, text)
+		}
+	}
+	html := parts["text/html"]
+	for _, want := range []string{
+		`<a href="https://go.dev/blog/feed.atom">Go Blog</a> (3)`,
+		`<a href="https://go.dev/blog/iter"><strong>Generics &amp; &lt;iterators&gt;</strong></a>`,
+		"Range over functions, explained — with examples.",
+		"...and 2 more; run gator browse for the rest.",
+	} {
+		if !strings.Contains(html, want) {
+			t.Errorf("HTML part is missing %q:\n%s", want, html)
+		}
+	}
+}
+
+func TestMailDigestNeedsConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Config
+	}{
+		{"no host", config.Config{SMTPFrom: "gator@example.com"}},
+		{"no sender", config.Config{SMTPHost: "localhost"}},
+		{"invalid sender", config.Config{SMTPHost: "localhost", SMTPFrom: "not an address"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := mailDigest(&tt.cfg, "alice@example.com", testDigest()); err == nil {
+				t.Error("mailDigest succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestDigestMessageHeaders(t *testing.T) {
+	date := time.Date(2026, 3, 4, 10, 0, 0, 0, time.UTC)
+	msg, err := digestMessage("gator@example.com", "alice@example.com", testDigest(), date)
+	if err != nil {
+		t.Fatalf("digestMessage failed: %v", err)
+	}
+	head, _, ok := strings.Cut(string(msg), "\r\n\r\n")
+	if !ok {
+		t.Fatal("message has no blank line after its headers")
+	}
+	for _, line := range strings.Split(head, "\r\n") {
+		if len(line) > 998 {
+			t.Errorf("header line is %d bytes long", len(line))
+		}
+	}
+	parsed, err := mail.ReadMessage(strings.NewReader(string(msg)))
+	if err != nil {
+		t.Fatalf("failed to parse message: %v", err)
+	}
+	if got := parsed.Header.Get("Date"); got != date.Format(time.RFC1123Z) {
+		t.Errorf("Date = %q", got)
+	}
+	if got := parsed.Header.Get("MIME-Version"); got != "1.0" {
+		t.Errorf("MIME-Version = %q", got)
+	}
+}
@@ -3,9 +3,21 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -18,22 +30,45 @@ func HandleLogin(s *state) error {
 		return errors.New("username is required")
 	}
 	username := s.args[0]
-	if _, err := s.queries.GetUserByName(context.Background(), username); errors.Is(err, sql.ErrNoRows) {
+	user, err := s.queries.GetUserByName(context.Background(), username)
+	if errors.Is(err, sql.ErrNoRows) {
 		return fmt.Errorf("user %s does not exist", username)
 	}
-	return s.config.SetUser(username)
+	if err != nil {
+		return fmt.Errorf("failed to get user %s: %w", username, err)
+	}
+	if err := s.config.SetUser(username); err != nil {
+		return err
+	}
+	if s.output != outputText {
+		return s.render(newUserRecord(user, true))
+	}
+	return nil
 }
 
 func HandleHelp(commands map[string]Command, s *state) error {
+	if s.output != outputText {
+		var records []commandRecord
+		for _, command := range commands {
+			if len(s.args) < 1 || command.Name == s.args[0] {
+				records = append(records, commandRecord{Name: command.Name, Description: command.Description})
+			}
+		}
+		if len(s.args) >= 1 && len(records) == 0 {
+			return errors.New("unknown command: " + s.args[0])
+		}
+		slices.SortFunc(records, func(a, b commandRecord) int { return strings.Compare(a.Name, b.Name) })
+		return s.render(records)
+	}
 	if len(s.args) < 1 {
 		for _, command := range commands {
-			println(command.Name + ": " + command.Description)
+			fmt.Println(command.Name + ": " + command.Description)
 		}
 		return nil
 	}
 	commandName := s.args[0]
 	if command, exists := commands[commandName]; exists {
-		println(command.Name + ": " + command.Description)
+		fmt.Println(command.Name + ": " + command.Description)
 		return nil
 	}
 	return errors.New("unknown command: " + commandName)
@@ -70,6 +105,9 @@ func HandleRegister(s *state) error {
 		return err
 	}
 
+	if s.output != outputText {
+		return s.render(newUserRecord(user, true))
+	}
 	fmt.Println("User registered:", user.Name)
 	fmt.Println(user.ID, user.CreatedAt, user.UpdatedAt, user.Name)
 
@@ -85,6 +123,9 @@ func HandleResetUsers(s *state) error {
 	if err != nil {
 		return fmt.Errorf("failed to clear current user: %w", err)
 	}
+	if s.output != outputText {
+		return s.render(messageRecord{Message: "all users have been reset"})
+	}
 	fmt.Println("All users have been reset.")
 	return nil
 }
@@ -94,6 +135,13 @@ func HandleGetUsers(s *state) error {
 	if err != nil {
 		return fmt.Errorf("failed to get users: %w", err)
 	}
+	if s.output != outputText {
+		records := make([]userRecord, 0, len(users))
+		for _, user := range users {
+			records = append(records, newUserRecord(user, user.Name == s.config.CurrentUserName))
+		}
+		return s.render(records)
+	}
 	if len(users) == 0 {
 		fmt.Println("No users found.")
 		return nil
@@ -109,25 +157,282 @@ func HandleGetUsers(s *state) error {
 }
 
 func HandleAgg(s *state) error {
+	fs := flag.NewFlagSet("agg", flag.ContinueOnError)
+	once := fs.Bool("once", false, "fetch every due feed once, then exit")
+	metricsAddr := fs.String("metrics-addr", "", "serve Prometheus metrics on this address, e.g. :9090")
+	overdueAfter := fs.Duration("overdue-after", 24*time.Hour, "report feeds not fetched for this long as overdue")
+	daemon := fs.Bool("daemon", false, "run as a service with health checks and a control socket")
+	listenAddr := fs.String("listen", "127.0.0.1:8080", "with --daemon, address for /healthz, /readyz and /metrics")
+	socketPath := fs.String("socket", defaultControlSocket(), "with --daemon, Unix socket for the control API")
+	singleton := fs.Bool("singleton", false, "only scrape while holding the database-wide aggregator lock")
+	standbyRetry := fs.Duration("standby-retry", 15*time.Second, "with --singleton, how often a standby tries to take over")
+	fs.DurationVar(&s.schedule.feedInterval, "feed-interval", s.schedule.feedInterval, "how often a feed with one inactive follower is fetched until its own interval is learned")
+	fs.BoolVar(&s.schedule.archiveUnfollowed, "archive-unfollowed", s.schedule.archiveUnfollowed, "keep fetching feeds that nobody follows")
+	fs.DurationVar(&s.schedule.minFeedInterval, "min-feed-interval", s.schedule.minFeedInterval, "shortest polling interval learned for a feed")
+	fs.DurationVar(&s.schedule.maxFeedInterval, "max-feed-interval", s.schedule.maxFeedInterval, "longest polling interval learned for a feed")
+	fs.DurationVar(&s.schedule.pruneInterval, "prune", 0, "prune posts expired by the retention policy at this interval, e.g. 1h")
+	fs.Func("digest", "email users a digest of new posts daily, weekly or at this interval", func(value string) error {
+		interval, err := parseDigestInterval(value)
+		s.schedule.digestInterval = interval
+		return err
+	})
+	args, err := parseArgs(fs, s.args)
+	if err != nil {
+		return err
+	}
+	if s.schedule.minFeedInterval > s.schedule.maxFeedInterval {
+		return fmt.Errorf("minimum feed interval %s is longer than maximum feed interval %s", s.schedule.minFeedInterval, s.schedule.maxFeedInterval)
+	}
+
+	var leader *leaderLock
+	if *singleton {
+		leader = &leaderLock{db: s.db}
+		defer leader.release()
+	}
+
+	if *once {
+		if leader != nil {
+			acquired, err := leader.tryAcquire(context.Background())
+			if err != nil {
+				return err
+			}
+			if !acquired {
+				return errors.New("another aggregator already holds leadership, not fetching")
+			}
+		}
+		dueParams := database.GetDueFeedsParams{
+			BaseIntervalSeconds: s.schedule.feedInterval.Seconds(),
+			IncludeUnfollowed:   s.schedule.archiveUnfollowed,
+		}
+		feeds, err := s.queries.GetDueFeeds(context.Background(), dueParams)
+		if err != nil {
+			return fmt.Errorf("failed to get due feeds: %w", err)
+		}
+		if err := refreshFeeds(s, feeds); err != nil {
+			return err
+		}
+		sendDueDigests(s)
+		pruneIfDue(s)
+		return nil
+	}
+	if s.output != outputText {
+		return errors.New("agg only prints results with --once; otherwise it logs as it runs")
+	}
+
 	var timeBetweenRequests time.Duration
-	if len(s.args) < 1 {
+	if len(args) < 1 {
 		return errors.New("time between requests is required")
 	} else {
-		var err error
-		timeBetweenRequests, err = time.ParseDuration(s.args[0])
+		timeBetweenRequests, err = time.ParseDuration(args[0])
 		if err != nil {
 			return fmt.Errorf("invalid duration: %w", err)
 		}
 	}
 
+	if *metricsAddr != "" || *daemon {
+		s.metrics.registerFeedGauges(s, *overdueAfter)
+	}
+	if *daemon {
+		return runDaemon(s, timeBetweenRequests, *listenAddr, *socketPath, leader, *standbyRetry)
+	}
+	if *metricsAddr != "" {
+		// Listen before scraping so that a bad address stops agg at once
+		metricsListener, err := net.Listen("tcp", *metricsAddr)
+		if err != nil {
+			return fmt.Errorf("failed to listen for metrics: %w", err)
+		}
+		defer metricsListener.Close()
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", s.metrics.registry.Handler())
+		go func() {
+			s.logger.Info("serving metrics", "addr", metricsListener.Addr().String())
+			if err := http.Serve(metricsListener, mux); err != nil && !errors.Is(err, net.ErrClosed) {
+				s.logger.Error("metrics server stopped", "error", err)
+			}
+		}()
+	}
+
 	ticker := time.NewTicker(timeBetweenRequests)
 	defer ticker.Stop()
 	for ; ; <-ticker.C {
+		if leader != nil && !leader.held(context.Background()) {
+			if err := leader.wait(context.Background(), s, *standbyRetry); err != nil {
+				return err
+			}
+		}
 		err := scrapeFeeds(s)
 		if err != nil {
 			return fmt.Errorf("error scraping feeds: %v", err)
 		}
+		sendDueDigests(s)
+		pruneIfDue(s)
+	}
+}
+
+func HandleAggCtl(s *state) error {
+	fs := flag.NewFlagSet("aggctl", flag.ContinueOnError)
+	socketPath := fs.String("socket", defaultControlSocket(), "Unix socket of the running aggregator")
+	args, err := parseArgs(fs, s.args)
+	if err != nil {
+		return err
+	}
+	if len(args) < 1 {
+		return errors.New("action is required: status, pause, resume or refresh <feed_url|feed_name>")
+	}
+
+	method, path := http.MethodPost, "/"+args[0]
+	switch args[0] {
+	case "status":
+		method = http.MethodGet
+	case "pause", "resume":
+	case "refresh":
+		if len(args) < 2 {
+			return errors.New("feed URL or name is required")
+		}
+		path += "?feed=" + url.QueryEscape(args[1])
+	default:
+		return fmt.Errorf("unknown action: %s", args[0])
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), method, "http://aggregator"+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := controlClient(*socketPath).Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach aggregator (is agg --daemon running?): %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("aggregator refused %s: %s", args[0], strings.TrimSpace(string(body)))
+	}
+	if s.output != outputText {
+		if args[0] != "status" {
+			return s.render(messageRecord{Message: strings.TrimSpace(string(body))})
+		}
+		var status aggregatorStatus
+		if err := json.Unmarshal(body, &status); err != nil {
+			return fmt.Errorf("failed to decode aggregator status: %w", err)
+		}
+		return s.render(status)
+	}
+	fmt.Print(string(body))
+	return nil
+}
+
+func HandleRefresh(s *state) error {
+	fs := flag.NewFlagSet("refresh", flag.ContinueOnError)
+	all := fs.Bool("all", false, "refresh every feed")
+	followed := fs.Bool("followed", false, "with --all, only refresh feeds followed by the current user")
+	args, err := parseArgs(fs, s.args)
+	if err != nil {
+		return err
+	}
+
+	if !*all {
+		if *followed {
+			return errors.New("--followed can only be used with --all")
+		}
+		if len(args) < 1 {
+			return errors.New("feed URL or name is required, or use --all")
+		}
+		feed, err := resolveFeed(s, args[0])
+		if err != nil {
+			return err
+		}
+		return refreshFeeds(s, []database.Feed{feed})
+	}
+
+	var feeds []database.Feed
+	if *followed {
+		user, err := getLoggedInUser(s)
+		if err != nil {
+			return fmt.Errorf("failed to get current user: %w", err)
+		}
+		feeds, err = s.queries.GetFollowedFeedsForUser(context.Background(), user.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get followed feeds for user %s: %w", user.Name, err)
+		}
+	} else {
+		feeds, err = s.queries.GetAllFeeds(context.Background())
+		if err != nil {
+			return fmt.Errorf("failed to get feeds: %w", err)
+		}
+	}
+	return refreshFeeds(s, feeds)
+}
+
+func HandleHistory(s *state) error {
+	fs := flag.NewFlagSet("history", flag.ContinueOnError)
+	limit := fs.Int("limit", 20, "number of fetches to show")
+	args, err := parseArgs(fs, s.args)
+	if err != nil {
+		return err
+	}
+	if len(args) < 1 {
+		return errors.New("feed URL or name is required")
+	}
+	feed, err := resolveFeed(s, args[0])
+	if err != nil {
+		return err
+	}
+
+	historyParams := database.GetFetchLogForFeedParams{
+		FeedID: feed.ID,
+		Limit:  int32(*limit),
+	}
+	entries, err := s.queries.GetFetchLogForFeed(context.Background(), historyParams)
+	if err != nil {
+		return fmt.Errorf("failed to get fetch history for feed %s: %w", feed.Name, err)
+	}
+	if s.output != outputText {
+		records := make([]fetchLogRecord, 0, len(entries))
+		for _, entry := range entries {
+			record := fetchLogRecord{
+				StartedAt:    entry.StartedAt,
+				DurationMs:   entry.DurationMs,
+				Bytes:        entry.Bytes,
+				ItemsSeen:    entry.ItemsSeen,
+				PostsNew:     entry.PostsNew,
+				PostsUpdated: entry.PostsUpdated,
+				Error:        nullString(entry.Error.String),
+			}
+			if entry.HttpStatus.Valid {
+				record.HTTPStatus = &entry.HttpStatus.Int32
+			}
+			records = append(records, record)
+		}
+		return s.render(records)
+	}
+	if len(entries) == 0 {
+		fmt.Printf("Feed %s has not been fetched yet.\n", feed.Name)
+		return nil
+	}
+
+	fmt.Printf("Fetch history for %s (%s):\n", feed.Name, feed.Url)
+	if feed.FetchIntervalSeconds.Valid {
+		fmt.Printf("Learned polling interval: %s\n", time.Duration(feed.FetchIntervalSeconds.Int32)*time.Second)
+	}
+	for _, entry := range entries {
+		status := "-"
+		if entry.HttpStatus.Valid {
+			status = strconv.Itoa(int(entry.HttpStatus.Int32))
+		}
+		fmt.Printf("Started At: %s\n", entry.StartedAt)
+		fmt.Printf("Duration: %s\n", time.Duration(entry.DurationMs)*time.Millisecond)
+		fmt.Printf("HTTP Status: %s\n", status)
+		fmt.Printf("Bytes: %d\n", entry.Bytes)
+		fmt.Printf("Items: %d seen, %d new, %d updated\n", entry.ItemsSeen, entry.PostsNew, entry.PostsUpdated)
+		if entry.Error.Valid {
+			fmt.Printf("Error: %s\n", entry.Error.String)
+		}
+		fmt.Println("-----------------------------")
 	}
+	return nil
 }
 
 func HandleCreateFeed(s *state) error {
@@ -159,15 +464,19 @@ func HandleCreateFeed(s *state) error {
 	if err != nil {
 		return fmt.Errorf("failed to create feed: %w", err)
 	}
-	s.args[0] = s.args[1] // change args for expected input of HandleFollow
 
+	follow, err := followFeed(s, user, newFeed)
+	if err != nil {
+		return fmt.Errorf("failed to follow feed after creation: %w", err)
+	}
+	if s.output != outputText {
+		return s.render(feedRecord{Name: newFeed.Name, URL: newFeed.Url, User: user.Name})
+	}
 	fmt.Printf("Feed created successfully: %s (%s)\n", newFeed.Name, newFeed.Url)
 	fmt.Printf("Feed ID: %s\n", newFeed.ID)
 	fmt.Printf("Created At: %s\n", newFeed.CreatedAt)
 	fmt.Printf("Updated At: %s\n", newFeed.UpdatedAt)
-	if err := HandleFollow(s); err != nil {
-		return fmt.Errorf("failed to follow feed after creation: %w", err)
-	}
+	fmt.Printf("User %s is now following feed %s\n", follow.UserName, follow.FeedName)
 	return nil
 }
 
@@ -176,6 +485,13 @@ func HandleGetFeeds(s *state) error {
 	if err != nil {
 		return fmt.Errorf("failed to get feeds: %w", err)
 	}
+	if s.output != outputText {
+		records := make([]feedRecord, 0, len(feeds))
+		for _, feed := range feeds {
+			records = append(records, feedRecord{Name: feed.Name, URL: feed.Url, User: feed.UserName})
+		}
+		return s.render(records)
+	}
 	if len(feeds) == 0 {
 		fmt.Println("No feeds found.")
 		return nil
@@ -208,6 +524,18 @@ func HandleFollow(s *state) error {
 	if err != nil {
 		return fmt.Errorf("failed to get current user: %w", err)
 	}
+	follow, err := followFeed(s, user, feed)
+	if err != nil {
+		return err
+	}
+	if s.output != outputText {
+		return s.render(followRecord{User: follow.UserName, Feed: follow.FeedName, Following: true})
+	}
+	fmt.Printf("User %s is now following feed %s\n", follow.UserName, follow.FeedName)
+	return nil
+}
+
+func followFeed(s *state, user database.User, feed database.Feed) (database.CreateFeedFollowRow, error) {
 	followParams := database.CreateFeedFollowParams{
 		ID:        uuid.New(),
 		CreatedAt: time.Now(),
@@ -217,13 +545,17 @@ func HandleFollow(s *state) error {
 	}
 	follow, err := s.queries.CreateFeedFollow(context.Background(), followParams)
 	if err != nil {
-		return fmt.Errorf("failed to create feed follow: %w", err)
+		return follow, fmt.Errorf("failed to create feed follow: %w", err)
 	}
-	fmt.Printf("User %s is now following feed %s\n", follow.UserName, follow.FeedName)
-	return nil
+	return follow, nil
 }
 
 func HandleGetFollows(s *state) error {
+	fs := flag.NewFlagSet("following", flag.ContinueOnError)
+	countMuted := fs.Bool("count-muted", false, "also show how many unread posts mute rules hide")
+	if _, err := parseArgs(fs, s.args); err != nil {
+		return err
+	}
 
 	user, err := getLoggedInUser(s)
 	if err != nil {
@@ -235,6 +567,17 @@ func HandleGetFollows(s *state) error {
 		return fmt.Errorf("failed to get followed feeds for user %s: %w", user.Name, err)
 	}
 
+	if s.output != outputText {
+		records := make([]followingRecord, 0, len(follows))
+		for _, follow := range follows {
+			records = append(records, followingRecord{
+				Feed:   follow.FeedName,
+				Unread: follow.UnreadCount,
+				Muted:  follow.MutedCount,
+			})
+		}
+		return s.render(records)
+	}
 	if len(follows) == 0 {
 		fmt.Printf("User %s is not following any feeds.\n", user.Name)
 		return nil
@@ -242,7 +585,11 @@ func HandleGetFollows(s *state) error {
 
 	fmt.Printf("Feeds followed by %s:\n", user.Name)
 	for _, follow := range follows {
-		fmt.Printf("- %s\n", follow.FeedName)
+		if *countMuted {
+			fmt.Printf("- %s (%d unread, %d muted)\n", follow.FeedName, follow.UnreadCount, follow.MutedCount)
+		} else {
+			fmt.Printf("- %s (%d unread)\n", follow.FeedName, follow.UnreadCount)
+		}
 	}
 	return nil
 }
@@ -275,14 +622,145 @@ func HandleUnfollow(s *state) error {
 		return fmt.Errorf("failed to unfollow feed: %w", err)
 	}
 
+	if s.output != outputText {
+		return s.render(followRecord{User: user.Name, Feed: feed.Name, Following: false})
+	}
 	fmt.Printf("User %s has unfollowed feed %s\n", user.Name, feed.Name)
 	return nil
 }
 
+func HandleMarkRead(s *state) error {
+	fs := flag.NewFlagSet("mark-read", flag.ContinueOnError)
+	feedRef := fs.String("feed", "", "mark every post in this feed (URL or name) as read")
+	before := fs.String("before", "", "mark every post published before a date or a duration ago like 30d as read")
+	args, err := parseArgs(fs, s.args)
+	if err != nil {
+		return err
+	}
+	user, err := getLoggedInUser(s)
+	if err != nil {
+		return fmt.Errorf("failed to get current user: %w", err)
+	}
+
+	var marked int64
+	switch {
+	case *feedRef != "":
+		feed, err := resolveFeed(s, *feedRef)
+		if err != nil {
+			return err
+		}
+		marked, err = s.queries.MarkFeedRead(context.Background(), database.MarkFeedReadParams{
+			UserID: user.ID,
+			FeedID: feed.ID,
+			ReadAt: time.Now(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to mark feed %s as read: %w", feed.Name, err)
+		}
+	case *before != "":
+		date, err := parseTimeOrAgo(*before, time.Now())
+		if err != nil {
+			return fmt.Errorf("invalid --before: %w", err)
+		}
+		marked, err = s.queries.MarkPostsReadBefore(context.Background(), database.MarkPostsReadBeforeParams{
+			UserID:      user.ID,
+			PublishedAt: date,
+			ReadAt:      time.Now(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to mark posts before %s as read: %w", *before, err)
+		}
+	case len(args) >= 1:
+		post, err := resolvePost(s, args[0])
+		if err != nil {
+			return err
+		}
+		marked, err = s.queries.MarkPostRead(context.Background(), database.MarkPostReadParams{
+			UserID: user.ID,
+			PostID: post.ID,
+			ReadAt: time.Now(),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to mark post as read: %w", err)
+		}
+	default:
+		return errors.New("post ID or URL, --feed or --before is required")
+	}
+
+	if s.output != outputText {
+		return s.render(markedRecord{Marked: marked})
+	}
+	fmt.Printf("Marked %d posts as read.\n", marked)
+	return nil
+}
+
+func HandleMarkUnread(s *state) error {
+	if len(s.args) < 1 {
+		return errors.New("post ID or URL is required")
+	}
+	post, err := resolvePost(s, s.args[0])
+	if err != nil {
+		return err
+	}
+	user, err := getLoggedInUser(s)
+	if err != nil {
+		return fmt.Errorf("failed to get current user: %w", err)
+	}
+	unreadParams := database.MarkPostUnreadParams{
+		UserID: user.ID,
+		PostID: post.ID,
+	}
+	marked, err := s.queries.MarkPostUnread(context.Background(), unreadParams)
+	if err != nil {
+		return fmt.Errorf("failed to mark post as unread: %w", err)
+	}
+	if s.output != outputText {
+		return s.render(markedRecord{Marked: marked})
+	}
+	fmt.Printf("Marked %d posts as unread.\n", marked)
+	return nil
+}
+
 func HandleBrowse(s *state) error {
+	fs := flag.NewFlagSet("browse", flag.ContinueOnError)
+	updated := fs.Bool("updated", false, "show posts that were edited after they were first fetched")
+	all := fs.Bool("all", false, "include posts that have already been read")
+	before := fs.String("before", "", "show posts older than this cursor")
+	after := fs.String("after", "", "show posts newer than this cursor")
+	offset := fs.Int("offset", 0, "skip this many posts")
+	since := fs.String("since", "", "show posts published since a date or a duration ago like 7d")
+	until := fs.String("until", "", "show posts published before a date or a duration ago like 7d")
+	var feeds, keywords, tags stringList
+	fs.Var(&feeds, "feed", "only show posts from this feed name or URL (repeatable)")
+	fs.Var(&keywords, "match", "only show posts whose title or description contains this text (repeatable)")
+	fs.Var(&tags, "tag", "only show posts you tagged with this tag, from any feed (repeatable)")
+	showMuted := fs.Bool("muted", false, "include posts hidden by your mute rules")
+	countMuted := fs.Bool("count-muted", false, "report how many matching posts your mute rules hide")
+	duplicates := fs.Bool("duplicates", false, "list every copy of a post that appears in several feeds")
+	args, err := parseArgs(fs, s.args)
+	if err != nil {
+		return err
+	}
+	if *before != "" && *after != "" {
+		return errors.New("--before and --after cannot be used together")
+	}
+	if *updated {
+		// Updated posts are listed by their own query, which filters on
+		// nothing but the user
+		var conflict string
+		fs.Visit(func(f *flag.Flag) {
+			if f.Name != "updated" && conflict == "" {
+				conflict = f.Name
+			}
+		})
+		if conflict != "" {
+			return fmt.Errorf("--updated cannot be used with --%s", conflict)
+		}
+	}
+
 	var limit int32 = 2
-	if len(s.args) >= 1 {
-		input, err := strconv.Atoi(s.args[0])
+	if len(args) >= 1 {
+		input, err := strconv.Atoi(args[0])
 		if err != nil {
 			return fmt.Errorf("invalid limit value: %w", err)
 		}
@@ -292,23 +770,1269 @@ func HandleBrowse(s *state) error {
 	if err != nil {
 		return fmt.Errorf("failed to get current user: %w", err)
 	}
-	browseParams := database.GetPostsForUserParams{
-		ID:    user.ID,
-		Limit: limit,
+	if *updated {
+		return browseUpdated(s, user, limit)
+	}
+
+	filter := database.PostFilter{
+		UserID:     user.ID,
+		UnreadOnly: !*all,
+		Keywords:   keywords,
+		ShowMuted:  *showMuted,
+		Limit:      limit,
+		Offset:     int32(*offset),
+	}
+	if filter.Tags, err = normalizeTags(tags); err != nil {
+		return err
+	}
+	// Tagged posts may come from feeds the user no longer follows, so only
+	// the timeline is collapsed
+	filter.CollapseDuplicates = !*duplicates && len(filter.Tags) == 0
+	for _, ref := range feeds {
+		feed, err := resolveFeed(s, ref)
+		if err != nil {
+			return err
+		}
+		filter.FeedIDs = append(filter.FeedIDs, feed.ID)
+	}
+	now := time.Now()
+	if *since != "" {
+		if filter.Since, err = parseTimeOrAgo(*since, now); err != nil {
+			return fmt.Errorf("invalid --since: %w", err)
+		}
+	}
+	if *until != "" {
+		if filter.Until, err = parseTimeOrAgo(*until, now); err != nil {
+			return fmt.Errorf("invalid --until: %w", err)
+		}
+	}
+	if *before != "" {
+		if filter.Before, err = decodeCursor(*before); err != nil {
+			return err
+		}
+	}
+	if *after != "" {
+		if filter.After, err = decodeCursor(*after); err != nil {
+			return err
+		}
 	}
-	posts, err := s.queries.GetPostsForUser(context.Background(), browseParams)
+
+	posts, err := s.queries.ListPosts(context.Background(), filter)
 	if err != nil {
 		return fmt.Errorf("failed to get posts for user %s: %w", user.Name, err)
 	}
+	if filter.After != nil {
+		// Fetched oldest first so the page starts right after the cursor
+		slices.Reverse(posts)
+	}
+	if *countMuted && !*showMuted {
+		hidden, err := s.queries.CountMutedPosts(context.Background(), filter)
+		if err != nil {
+			return fmt.Errorf("failed to count muted posts: %w", err)
+		}
+		defer reportMuted(s, hidden)
+	}
+
+	if s.output != outputText {
+		records := make([]postRecord, 0, len(posts))
+		for _, post := range posts {
+			records = append(records, postRecord{
+				PostID:      post.ShortID,
+				Title:       post.Title,
+				URL:         post.Url,
+				Feed:        post.FeedName,
+				PublishedAt: post.PublishedAt,
+				Read:        post.IsRead,
+				Starred:     post.IsStarred,
+				Cursor:      encodeCursor(post.PublishedAt, post.ID),
+				Sources:     post.Sources,
+			})
+		}
+		return s.render(records)
+	}
+	if len(posts) == 0 {
+		if *all {
+			fmt.Printf("User %s has no matching posts from followed feeds.\n", user.Name)
+		} else {
+			fmt.Printf("User %s has no matching unread posts from followed feeds.\n", user.Name)
+		}
+		return nil
+	}
+	for _, post := range posts {
+		fmt.Printf("Post ID: %d\n", post.ShortID)
+		if post.IsRead {
+			fmt.Printf("Post Title: %s (read)\n", post.Title)
+		} else {
+			fmt.Printf("Post Title: %s\n", post.Title)
+		}
+		fmt.Printf("Post URL: %s\n", post.Url)
+		fmt.Printf("Published At: %s\n", post.PublishedAt)
+		if len(post.Sources) > 1 {
+			fmt.Printf("Feeds: %s\n", strings.Join(post.Sources, ", "))
+		}
+		fmt.Println("-----------------------------")
+	}
+
+	// A full page may have more beyond it; paging in from either side means
+	// there is more on the side we came from.
+	full := len(posts) == int(limit)
+	hasOlder := full || *after != ""
+	hasNewer := *before != "" || *offset > 0 || (*after != "" && full)
+	if hasNewer {
+		first := posts[0]
+		fmt.Printf("Newer posts: browse --after %s\n", encodeCursor(first.PublishedAt, first.ID))
+	}
+	if hasOlder {
+		last := posts[len(posts)-1]
+		fmt.Printf("Older posts: browse --before %s\n", encodeCursor(last.PublishedAt, last.ID))
+	}
+	return nil
+}
+
+func browseUpdated(s *state, user database.User, limit int32) error {
+	updatedParams := database.GetUpdatedPostsForUserParams{
+		UserID: user.ID,
+		Limit:  limit,
+	}
+	posts, err := s.queries.GetUpdatedPostsForUser(context.Background(), updatedParams)
+	if err != nil {
+		return fmt.Errorf("failed to get updated posts for user %s: %w", user.Name, err)
+	}
+	if s.output != outputText {
+		records := make([]updatedPostRecord, 0, len(posts))
+		for _, post := range posts {
+			records = append(records, updatedPostRecord{
+				PostID:      post.ShortID,
+				Title:       post.Title,
+				URL:         post.Url,
+				Feed:        post.FeedName,
+				PublishedAt: post.PublishedAt,
+				UpdatedAt:   post.UpdatedAt,
+				Revisions:   post.RevisionCount,
+			})
+		}
+		return s.render(records)
+	}
 	if len(posts) == 0 {
-		fmt.Printf("User %s is has no posts from followed feeds.\n", user.Name)
+		fmt.Printf("User %s has no updated posts from followed feeds.\n", user.Name)
 		return nil
 	}
 	for _, post := range posts {
+		fmt.Printf("Post ID: %d\n", post.ShortID)
 		fmt.Printf("Post Title: %s\n", post.Title)
 		fmt.Printf("Post URL: %s\n", post.Url)
 		fmt.Printf("Published At: %s\n", post.PublishedAt)
+		fmt.Printf("Updated At: %s (%d earlier revisions)\n", post.UpdatedAt, post.RevisionCount)
+		fmt.Println("-----------------------------")
+	}
+	return nil
+}
+
+func HandleDiff(s *state) error {
+	if len(s.args) < 1 {
+		return errors.New("post ID or URL is required")
+	}
+	post, err := resolvePost(s, s.args[0])
+	if err != nil {
+		return err
+	}
+
+	revisions, err := s.queries.GetPostRevisions(context.Background(), post.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get revisions for post %s: %w", post.Title, err)
+	}
+	if len(revisions) == 0 && s.output == outputText {
+		fmt.Printf("Post %s has not changed since it was first fetched.\n", post.Title)
+		return nil
+	}
+
+	// Each revision is followed by the version that replaced it
+	versions := make([]database.PostRevision, 0, len(revisions)+1)
+	versions = append(versions, revisions...)
+	versions = append(versions, database.PostRevision{
+		UpdatedAt:   post.UpdatedAt,
+		Title:       post.Title,
+		Description: post.Description,
+		Content:     post.Content,
+	})
+	if s.output != outputText {
+		var records []changeRecord
+		for i := 1; i < len(versions); i++ {
+			old, new := versions[i-1], versions[i]
+			fields := []struct{ name, old, new string }{
+				{"title", old.Title, new.Title},
+				{"description", old.Description.String, new.Description.String},
+				{"content", old.Content.String, new.Content.String},
+			}
+			for _, field := range fields {
+				if field.old != field.new {
+					records = append(records, changeRecord{
+						ChangedAt: new.UpdatedAt,
+						Field:     field.name,
+						Diff:      strings.Join(diffLines(field.old, field.new), "\n"),
+					})
+				}
+			}
+		}
+		return s.render(records)
+	}
+	for i := 1; i < len(versions); i++ {
+		old, new := versions[i-1], versions[i]
+		fmt.Printf("Changes at %s:\n", new.UpdatedAt)
+		printFieldDiff("Title", old.Title, new.Title)
+		printFieldDiff("Description", old.Description.String, new.Description.String)
+		printFieldDiff("Content", old.Content.String, new.Content.String)
 		fmt.Println("-----------------------------")
 	}
 	return nil
 }
+
+func printFieldDiff(field, old, new string) {
+	if old == new {
+		return
+	}
+	fmt.Printf("%s:\n", field)
+	for _, line := range diffLines(old, new) {
+		fmt.Println(line)
+	}
+}
+
+func HandleStar(s *state) error {
+	if len(s.args) < 1 {
+		return errors.New("post ID or URL is required")
+	}
+	post, err := resolvePost(s, s.args[0])
+	if err != nil {
+		return err
+	}
+	user, err := getLoggedInUser(s)
+	if err != nil {
+		return fmt.Errorf("failed to get current user: %w", err)
+	}
+	starParams := database.StarPostParams{
+		UserID:    user.ID,
+		PostID:    post.ID,
+		CreatedAt: time.Now(),
+	}
+	if _, err := s.queries.StarPost(context.Background(), starParams); err != nil {
+		return fmt.Errorf("failed to star post: %w", err)
+	}
+	if s.output != outputText {
+		return s.render(starRecord{PostID: post.ShortID, Title: post.Title, URL: post.Url, Starred: true})
+	}
+	fmt.Printf("Starred post %d: %s\n", post.ShortID, post.Title)
+	return nil
+}
+
+func HandleUnstar(s *state) error {
+	if len(s.args) < 1 {
+		return errors.New("post ID or URL is required")
+	}
+	post, err := resolvePost(s, s.args[0])
+	if err != nil {
+		return err
+	}
+	user, err := getLoggedInUser(s)
+	if err != nil {
+		return fmt.Errorf("failed to get current user: %w", err)
+	}
+	unstarParams := database.UnstarPostParams{
+		UserID: user.ID,
+		PostID: post.ID,
+	}
+	removed, err := s.queries.UnstarPost(context.Background(), unstarParams)
+	if err != nil {
+		return fmt.Errorf("failed to unstar post: %w", err)
+	}
+	if removed == 0 {
+		return fmt.Errorf("post %d is not starred", post.ShortID)
+	}
+	if s.output != outputText {
+		return s.render(starRecord{PostID: post.ShortID, Title: post.Title, URL: post.Url, Starred: false})
+	}
+	fmt.Printf("Unstarred post %d: %s\n", post.ShortID, post.Title)
+	return nil
+}
+
+func HandleStarred(s *state) error {
+	var limit int32 = 20
+	if len(s.args) >= 1 {
+		input, err := strconv.Atoi(s.args[0])
+		if err != nil {
+			return fmt.Errorf("invalid limit value: %w", err)
+		}
+		limit = int32(input)
+	}
+	user, err := getLoggedInUser(s)
+	if err != nil {
+		return fmt.Errorf("failed to get current user: %w", err)
+	}
+	starredParams := database.GetStarredPostsForUserParams{
+		UserID: user.ID,
+		Limit:  limit,
+	}
+	posts, err := s.queries.GetStarredPostsForUser(context.Background(), starredParams)
+	if err != nil {
+		return fmt.Errorf("failed to get starred posts for user %s: %w", user.Name, err)
+	}
+	if s.output != outputText {
+		records := make([]starredPostRecord, 0, len(posts))
+		for _, post := range posts {
+			records = append(records, starredPostRecord{
+				PostID:      post.ShortID,
+				Title:       post.Title,
+				URL:         post.Url,
+				Feed:        post.FeedName,
+				PublishedAt: post.PublishedAt,
+				StarredAt:   post.StarredAt,
+			})
+		}
+		return s.render(records)
+	}
+	if len(posts) == 0 {
+		fmt.Printf("User %s has no starred posts.\n", user.Name)
+		return nil
+	}
+	for _, post := range posts {
+		fmt.Printf("Post ID: %d\n", post.ShortID)
+		fmt.Printf("Post Title: %s\n", post.Title)
+		fmt.Printf("Post URL: %s\n", post.Url)
+		fmt.Printf("Feed: %s\n", post.FeedName)
+		fmt.Printf("Starred At: %s\n", post.StarredAt)
+		fmt.Println("-----------------------------")
+	}
+	return nil
+}
+
+func HandleSearch(s *state) error {
+	fs := flag.NewFlagSet("search", flag.ContinueOnError)
+	allFeeds := fs.Bool("all", false, "search every feed, not just the ones you follow")
+	limit := fs.Int("limit", 10, "number of results to show")
+	showMuted := fs.Bool("muted", false, "include posts hidden by your mute rules")
+	countMuted := fs.Bool("count-muted", false, "report how many matching posts your mute rules hide")
+	args, err := parseArgs(fs, s.args)
+	if err != nil {
+		return err
+	}
+	if len(args) < 1 {
+		return errors.New("search query is required")
+	}
+	query := strings.Join(args, " ")
+
+	user, err := getLoggedInUser(s)
+	if err != nil {
+		return fmt.Errorf("failed to get current user: %w", err)
+	}
+	searchParams := database.SearchPostsParams{
+		UserID:    user.ID,
+		Query:     query,
+		AllFeeds:  *allFeeds,
+		Limit:     int32(*limit),
+		ShowMuted: *showMuted,
+	}
+	posts, err := s.queries.SearchPosts(context.Background(), searchParams)
+	if err != nil {
+		return fmt.Errorf("failed to search posts: %w", err)
+	}
+	if *countMuted && !*showMuted {
+		countParams := database.CountMutedSearchResultsParams{
+			UserID:   user.ID,
+			Query:    query,
+			AllFeeds: *allFeeds,
+		}
+		hidden, err := s.queries.CountMutedSearchResults(context.Background(), countParams)
+		if err != nil {
+			return fmt.Errorf("failed to count muted posts: %w", err)
+		}
+		defer reportMuted(s, hidden)
+	}
+	if s.output != outputText {
+		records := make([]searchResultRecord, 0, len(posts))
+		for _, post := range posts {
+			records = append(records, searchResultRecord{
+				PostID:      post.ShortID,
+				Title:       post.Title,
+				URL:         post.Url,
+				Feed:        post.FeedName,
+				PublishedAt: post.PublishedAt,
+				Rank:        post.Rank,
+			})
+		}
+		return s.render(records)
+	}
+	if len(posts) == 0 {
+		fmt.Printf("No posts match %s.\n", query)
+		return nil
+	}
+	for _, post := range posts {
+		fmt.Printf("Post ID: %d\n", post.ShortID)
+		fmt.Printf("Post Title: %s\n", post.Title)
+		fmt.Printf("Post URL: %s\n", post.Url)
+		fmt.Printf("Feed: %s\n", post.FeedName)
+		fmt.Printf("Published At: %s\n", post.PublishedAt)
+		fmt.Println("-----------------------------")
+	}
+	return nil
+}
+
+func HandleOpen(s *state) error {
+	if len(s.args) < 1 {
+		return errors.New("post ID or URL is required")
+	}
+	post, err := resolvePost(s, s.args[0])
+	if err != nil {
+		return err
+	}
+	user, err := getLoggedInUser(s)
+	if err != nil {
+		return fmt.Errorf("failed to get current user: %w", err)
+	}
+	if err := openURL(post.Url); err != nil {
+		return err
+	}
+	readParams := database.MarkPostReadParams{
+		UserID: user.ID,
+		PostID: post.ID,
+		ReadAt: time.Now(),
+	}
+	if _, err := s.queries.MarkPostRead(context.Background(), readParams); err != nil {
+		return fmt.Errorf("failed to mark post as read: %w", err)
+	}
+	if s.output != outputText {
+		return s.render(openedRecord{PostID: post.ShortID, URL: post.Url})
+	}
+	fmt.Printf("Opened post %d: %s\n", post.ShortID, post.Url)
+	return nil
+}
+
+func HandleRead(s *state) error {
+	if len(s.args) < 1 {
+		return errors.New("post ID or URL is required")
+	}
+	post, err := resolvePost(s, s.args[0])
+	if err != nil {
+		return err
+	}
+	user, err := getLoggedInUser(s)
+	if err != nil {
+		return fmt.Errorf("failed to get current user: %w", err)
+	}
+	if s.output != outputText {
+		body := post.Content.String
+		if body == "" {
+			body = post.Description.String
+		}
+		record := postTextRecord{
+			PostID:      post.ShortID,
+			Title:       post.Title,
+			URL:         post.Url,
+			PublishedAt: post.PublishedAt,
+			Text:        plainText(body),
+		}
+		if err := s.render(record); err != nil {
+			return err
+		}
+	} else if err := page(strings.Join(wrapText(renderPost(post), 78), "\n")); err != nil {
+		return err
+	}
+	readParams := database.MarkPostReadParams{
+		UserID: user.ID,
+		PostID: post.ID,
+		ReadAt: time.Now(),
+	}
+	if _, err := s.queries.MarkPostRead(context.Background(), readParams); err != nil {
+		return fmt.Errorf("failed to mark post as read: %w", err)
+	}
+	return nil
+}
+
+func newUserRecord(user database.User, current bool) userRecord {
+	return userRecord{
+		ID:        user.ID.String(),
+		Name:      user.Name,
+		CreatedAt: user.CreatedAt,
+		Current:   current,
+	}
+}
+
+func HandleTag(s *state) error {
+	fs := flag.NewFlagSet("tag", flag.ContinueOnError)
+	query := fs.String("search", "", "tag every post matching this search query instead of a single post")
+	allFeeds := fs.Bool("all", false, "with --search, match posts in every feed, not just the ones you follow")
+	args, err := parseArgs(fs, s.args)
+	if err != nil {
+		return err
+	}
+
+	var post database.Post
+	names := args
+	if *query == "" {
+		if len(args) < 2 {
+			return errors.New("post ID or URL and at least one tag are required")
+		}
+		post, err = resolvePost(s, args[0])
+		if err != nil {
+			return err
+		}
+		names = args[1:]
+	} else if len(args) < 1 {
+		return errors.New("at least one tag is required")
+	}
+	names, err = normalizeTags(names)
+	if err != nil {
+		return err
+	}
+	user, err := getLoggedInUser(s)
+	if err != nil {
+		return fmt.Errorf("failed to get current user: %w", err)
+	}
+
+	records := make([]tagRecord, 0, len(names))
+	for _, name := range names {
+		tagParams := database.UpsertTagParams{
+			ID:        uuid.New(),
+			UserID:    user.ID,
+			Name:      name,
+			CreatedAt: time.Now(),
+		}
+		tag, err := s.queries.UpsertTag(context.Background(), tagParams)
+		if err != nil {
+			return fmt.Errorf("failed to create tag %s: %w", name, err)
+		}
+		var tagged int64
+		if *query == "" {
+			tagged, err = s.queries.TagPost(context.Background(), database.TagPostParams{
+				TagID:     tag.ID,
+				PostID:    post.ID,
+				CreatedAt: time.Now(),
+			})
+		} else {
+			tagged, err = s.queries.TagPostsMatching(context.Background(), database.TagPostsMatchingParams{
+				TagID:     tag.ID,
+				CreatedAt: time.Now(),
+				Query:     *query,
+				AllFeeds:  *allFeeds,
+				UserID:    user.ID,
+			})
+		}
+		if err != nil {
+			return fmt.Errorf("failed to tag posts with %s: %w", name, err)
+		}
+		records = append(records, tagRecord{Tag: name, Posts: tagged})
+	}
+
+	if s.output != outputText {
+		return s.render(records)
+	}
+	for _, record := range records {
+		if *query == "" {
+			fmt.Printf("Tagged post %d with %s\n", post.ShortID, record.Tag)
+		} else {
+			fmt.Printf("Tagged %d posts matching %s with %s\n", record.Posts, *query, record.Tag)
+		}
+	}
+	return nil
+}
+
+func HandleUntag(s *state) error {
+	if len(s.args) < 2 {
+		return errors.New("post ID or URL and at least one tag are required")
+	}
+	post, err := resolvePost(s, s.args[0])
+	if err != nil {
+		return err
+	}
+	names, err := normalizeTags(s.args[1:])
+	if err != nil {
+		return err
+	}
+	user, err := getLoggedInUser(s)
+	if err != nil {
+		return fmt.Errorf("failed to get current user: %w", err)
+	}
+
+	records := make([]tagRecord, 0, len(names))
+	for _, name := range names {
+		untagParams := database.UntagPostParams{
+			UserID: user.ID,
+			Name:   name,
+			PostID: post.ID,
+		}
+		untagged, err := s.queries.UntagPost(context.Background(), untagParams)
+		if err != nil {
+			return fmt.Errorf("failed to remove tag %s: %w", name, err)
+		}
+		records = append(records, tagRecord{Tag: name, Posts: untagged})
+	}
+	// Tags exist only while something is tagged with them
+	if err := s.queries.DeleteUnusedTags(context.Background(), user.ID); err != nil {
+		return fmt.Errorf("failed to clean up unused tags: %w", err)
+	}
+
+	if s.output != outputText {
+		return s.render(records)
+	}
+	for _, record := range records {
+		if record.Posts == 0 {
+			fmt.Printf("Post %d is not tagged %s\n", post.ShortID, record.Tag)
+		} else {
+			fmt.Printf("Removed tag %s from post %d\n", record.Tag, post.ShortID)
+		}
+	}
+	return nil
+}
+
+func HandleTags(s *state) error {
+	user, err := getLoggedInUser(s)
+	if err != nil {
+		return fmt.Errorf("failed to get current user: %w", err)
+	}
+	tags, err := s.queries.GetTagsForUser(context.Background(), user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get tags for user %s: %w", user.Name, err)
+	}
+	if s.output != outputText {
+		records := make([]tagRecord, 0, len(tags))
+		for _, tag := range tags {
+			records = append(records, tagRecord{Tag: tag.Name, Posts: tag.PostCount})
+		}
+		return s.render(records)
+	}
+	if len(tags) == 0 {
+		fmt.Printf("User %s has not tagged any posts.\n", user.Name)
+		return nil
+	}
+	fmt.Printf("Tags used by %s:\n", user.Name)
+	for _, tag := range tags {
+		fmt.Printf("- %s (%d posts)\n", tag.Name, tag.PostCount)
+	}
+	return nil
+}
+
+// reportMuted tells the user how many posts their mute rules hid. Records
+// printed with --output stay parsable by logging the count instead.
+func reportMuted(s *state, hidden int64) {
+	if s.output != outputText {
+		s.logger.Info("posts hidden by mute rules", "count", hidden)
+		return
+	}
+	fmt.Printf("%d posts hidden by mute rules.\n", hidden)
+}
+
+func HandleMute(s *state) error {
+	if len(s.args) < 1 {
+		return errors.New("action is required: add, list or remove")
+	}
+	action := s.args[0]
+	s.args = s.args[1:]
+	switch action {
+	case "add":
+		return muteAdd(s)
+	case "list":
+		return muteList(s)
+	case "remove":
+		return muteRemove(s)
+	default:
+		return fmt.Errorf("unknown action: %s", action)
+	}
+}
+
+func muteAdd(s *state) error {
+	fs := flag.NewFlagSet("mute add", flag.ContinueOnError)
+	feedRef := fs.String("feed", "", "only mute posts in this feed (URL or name)")
+	args, err := parseArgs(fs, s.args)
+	if err != nil {
+		return err
+	}
+	if len(args) < 2 {
+		return errors.New("rule kind (keyword, regex, author or category) and pattern are required")
+	}
+	kind, pattern := args[0], strings.Join(args[1:], " ")
+	switch kind {
+	case "keyword", "author", "category":
+	case "regex":
+		if err := checkRegex(s, pattern); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown rule kind %s, use keyword, regex, author or category", kind)
+	}
+	user, err := getLoggedInUser(s)
+	if err != nil {
+		return fmt.Errorf("failed to get current user: %w", err)
+	}
+
+	ruleParams := database.CreateMuteRuleParams{
+		UserID:    user.ID,
+		Kind:      kind,
+		Pattern:   pattern,
+		CreatedAt: time.Now(),
+	}
+	feedName := ""
+	if *feedRef != "" {
+		feed, err := resolveFeed(s, *feedRef)
+		if err != nil {
+			return err
+		}
+		ruleParams.FeedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+		feedName = feed.Name
+	}
+	rule, err := s.queries.CreateMuteRule(context.Background(), ruleParams)
+	if err != nil {
+		return fmt.Errorf("failed to create mute rule: %w", err)
+	}
+
+	if s.output != outputText {
+		return s.render(muteRecord{ID: rule.ID, Kind: rule.Kind, Pattern: rule.Pattern, Feed: nullString(feedName)})
+	}
+	fmt.Printf("Added mute rule %d: %s\n", rule.ID, describeRule(rule.Kind, rule.Pattern, feedName))
+	return nil
+}
+
+func muteList(s *state) error {
+	user, err := getLoggedInUser(s)
+	if err != nil {
+		return fmt.Errorf("failed to get current user: %w", err)
+	}
+	rules, err := s.queries.GetMuteRulesForUser(context.Background(), user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get mute rules for user %s: %w", user.Name, err)
+	}
+	if s.output != outputText {
+		records := make([]muteRecord, 0, len(rules))
+		for _, rule := range rules {
+			records = append(records, muteRecord{
+				ID:      rule.ID,
+				Kind:    rule.Kind,
+				Pattern: rule.Pattern,
+				Feed:    nullString(rule.FeedName.String),
+			})
+		}
+		return s.render(records)
+	}
+	if len(rules) == 0 {
+		fmt.Printf("User %s has no mute rules.\n", user.Name)
+		return nil
+	}
+	fmt.Printf("Mute rules for %s:\n", user.Name)
+	for _, rule := range rules {
+		fmt.Printf("%d: %s\n", rule.ID, describeRule(rule.Kind, rule.Pattern, rule.FeedName.String))
+	}
+	return nil
+}
+
+func muteRemove(s *state) error {
+	if len(s.args) < 1 {
+		return errors.New("mute rule ID is required")
+	}
+	id, err := strconv.ParseInt(s.args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid mute rule ID: %s", s.args[0])
+	}
+	user, err := getLoggedInUser(s)
+	if err != nil {
+		return fmt.Errorf("failed to get current user: %w", err)
+	}
+	removeParams := database.DeleteMuteRuleParams{
+		ID:     id,
+		UserID: user.ID,
+	}
+	removed, err := s.queries.DeleteMuteRule(context.Background(), removeParams)
+	if err != nil {
+		return fmt.Errorf("failed to remove mute rule: %w", err)
+	}
+	if removed == 0 {
+		return fmt.Errorf("user %s has no mute rule %d", user.Name, id)
+	}
+	if s.output != outputText {
+		return s.render(messageRecord{Message: fmt.Sprintf("removed mute rule %d", id)})
+	}
+	fmt.Printf("Removed mute rule %d\n", id)
+	return nil
+}
+
+func describeRule(kind, pattern, feedName string) string {
+	scope := "all feeds"
+	if feedName != "" {
+		scope = feedName
+	}
+	return fmt.Sprintf("%s %q in %s", kind, pattern, scope)
+}
+
+func HandleAlert(s *state) error {
+	if len(s.args) < 1 {
+		return errors.New("action is required: add, list or remove")
+	}
+	action := s.args[0]
+	s.args = s.args[1:]
+	switch action {
+	case "add":
+		return alertAdd(s)
+	case "list":
+		return alertList(s)
+	case "remove":
+		return alertRemove(s)
+	default:
+		return fmt.Errorf("unknown action: %s", action)
+	}
+}
+
+func alertAdd(s *state) error {
+	fs := flag.NewFlagSet("alert add", flag.ContinueOnError)
+	feedRef := fs.String("feed", "", "only alert on posts in this feed (URL or name)")
+	command := fs.String("command", "", "shell command to run, with the post as JSON on stdin")
+	webhook := fs.String("webhook", "", "URL to POST the post to as JSON")
+	args, err := parseArgs(fs, s.args)
+	if err != nil {
+		return err
+	}
+	if len(args) < 2 {
+		return errors.New("rule kind (keyword or regex) and pattern are required")
+	}
+	kind, pattern := args[0], strings.Join(args[1:], " ")
+	switch kind {
+	case "keyword":
+	case "regex":
+		if err := checkRegex(s, pattern); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown rule kind %s, use keyword or regex", kind)
+	}
+	if *command == "" && *webhook == "" {
+		return errors.New("--command or --webhook is required")
+	}
+	if *webhook != "" {
+		if u, err := url.Parse(*webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid webhook URL: %s", *webhook)
+		}
+	}
+	user, err := getLoggedInUser(s)
+	if err != nil {
+		return fmt.Errorf("failed to get current user: %w", err)
+	}
+
+	ruleParams := database.CreateAlertRuleParams{
+		UserID:     user.ID,
+		Kind:       kind,
+		Pattern:    pattern,
+		Command:    sql.NullString{String: *command, Valid: *command != ""},
+		WebhookUrl: sql.NullString{String: *webhook, Valid: *webhook != ""},
+		CreatedAt:  time.Now(),
+	}
+	feedName := ""
+	if *feedRef != "" {
+		feed, err := resolveFeed(s, *feedRef)
+		if err != nil {
+			return err
+		}
+		ruleParams.FeedID = uuid.NullUUID{UUID: feed.ID, Valid: true}
+		feedName = feed.Name
+	}
+	rule, err := s.queries.CreateAlertRule(context.Background(), ruleParams)
+	if err != nil {
+		return fmt.Errorf("failed to create alert rule: %w", err)
+	}
+
+	if s.output != outputText {
+		return s.render(alertRecord{
+			ID:      rule.ID,
+			Kind:    rule.Kind,
+			Pattern: rule.Pattern,
+			Feed:    nullString(feedName),
+			Command: nullString(rule.Command.String),
+			Webhook: nullString(rule.WebhookUrl.String),
+		})
+	}
+	fmt.Printf("Added alert %d: %s\n", rule.ID, describeRule(rule.Kind, rule.Pattern, feedName))
+	printAlertHooks(rule.Command, rule.WebhookUrl)
+	return nil
+}
+
+func alertList(s *state) error {
+	user, err := getLoggedInUser(s)
+	if err != nil {
+		return fmt.Errorf("failed to get current user: %w", err)
+	}
+	rules, err := s.queries.GetAlertRulesForUser(context.Background(), user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get alert rules for user %s: %w", user.Name, err)
+	}
+	if s.output != outputText {
+		records := make([]alertRecord, 0, len(rules))
+		for _, rule := range rules {
+			records = append(records, alertRecord{
+				ID:         rule.ID,
+				Kind:       rule.Kind,
+				Pattern:    rule.Pattern,
+				Feed:       nullString(rule.FeedName.String),
+				Command:    nullString(rule.Command.String),
+				Webhook:    nullString(rule.WebhookUrl.String),
+				Deliveries: rule.DeliveryCount,
+			})
+		}
+		return s.render(records)
+	}
+	if len(rules) == 0 {
+		fmt.Printf("User %s has no alerts.\n", user.Name)
+		return nil
+	}
+	fmt.Printf("Alerts for %s:\n", user.Name)
+	for _, rule := range rules {
+		fmt.Printf("%d: %s, sent %d times\n", rule.ID, describeRule(rule.Kind, rule.Pattern, rule.FeedName.String), rule.DeliveryCount)
+		printAlertHooks(rule.Command, rule.WebhookUrl)
+	}
+	return nil
+}
+
+func printAlertHooks(command, webhook sql.NullString) {
+	if command.Valid {
+		fmt.Printf("   run:  %s\n", command.String)
+	}
+	if webhook.Valid {
+		fmt.Printf("   post: %s\n", webhook.String)
+	}
+}
+
+func alertRemove(s *state) error {
+	if len(s.args) < 1 {
+		return errors.New("alert ID is required")
+	}
+	id, err := strconv.ParseInt(s.args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid alert ID: %s", s.args[0])
+	}
+	user, err := getLoggedInUser(s)
+	if err != nil {
+		return fmt.Errorf("failed to get current user: %w", err)
+	}
+	removeParams := database.DeleteAlertRuleParams{
+		ID:     id,
+		UserID: user.ID,
+	}
+	removed, err := s.queries.DeleteAlertRule(context.Background(), removeParams)
+	if err != nil {
+		return fmt.Errorf("failed to remove alert: %w", err)
+	}
+	if removed == 0 {
+		return fmt.Errorf("user %s has no alert %d", user.Name, id)
+	}
+	if s.output != outputText {
+		return s.render(messageRecord{Message: fmt.Sprintf("removed alert %d", id)})
+	}
+	fmt.Printf("Removed alert %d\n", id)
+	return nil
+}
+
+func HandleEmail(s *state) error {
+	fs := flag.NewFlagSet("email", flag.ContinueOnError)
+	clearEmail := fs.Bool("clear", false, "remove the current user's email address and stop their digests")
+	args, err := parseArgs(fs, s.args)
+	if err != nil {
+		return err
+	}
+	user, err := getLoggedInUser(s)
+	if err != nil {
+		return fmt.Errorf("failed to get current user: %w", err)
+	}
+
+	if len(args) == 0 && !*clearEmail {
+		if s.output != outputText {
+			return s.render(emailRecord{User: user.Name, Email: nullString(user.Email.String)})
+		}
+		if !user.Email.Valid {
+			fmt.Printf("User %s has no email address.\n", user.Name)
+			return nil
+		}
+		fmt.Printf("%s <%s>\n", user.Name, user.Email.String)
+		return nil
+	}
+
+	var email sql.NullString
+	if !*clearEmail {
+		address, err := mail.ParseAddress(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid email address %s: %w", args[0], err)
+		}
+		email = sql.NullString{String: address.Address, Valid: true}
+	}
+	emailParams := database.SetUserEmailParams{
+		ID:        user.ID,
+		Email:     email,
+		UpdatedAt: time.Now(),
+	}
+	if err := s.queries.SetUserEmail(context.Background(), emailParams); err != nil {
+		return fmt.Errorf("failed to set email address: %w", err)
+	}
+	if s.output != outputText {
+		return s.render(emailRecord{User: user.Name, Email: nullString(email.String)})
+	}
+	if !email.Valid {
+		fmt.Printf("Removed the email address of %s\n", user.Name)
+		return nil
+	}
+	fmt.Printf("Set the email address of %s to %s\n", user.Name, email.String)
+	return nil
+}
+
+func HandleDigest(s *state) error {
+	fs := flag.NewFlagSet("digest", flag.ContinueOnError)
+	send := fs.Bool("send", false, "email the digest to the current user's address")
+	file := fs.String("file", "", "write the digest to this file, as HTML if it ends in .html or .htm")
+	sinceFlag := fs.String("since", "", "include posts since this date or age (e.g. 7d) instead of since the last digest")
+	limit := fs.Int("limit", defaultDigestFeedLimit, "most posts to list from each feed")
+	if _, err := parseArgs(fs, s.args); err != nil {
+		return err
+	}
+	if *limit <= 0 {
+		return errors.New("--limit must be positive")
+	}
+	user, err := getLoggedInUser(s)
+	if err != nil {
+		return fmt.Errorf("failed to get current user: %w", err)
+	}
+	if *send && !user.Email.Valid {
+		return fmt.Errorf("user %s has no email address, set one with: gator email <address>", user.Name)
+	}
+
+	now := time.Now().Truncate(time.Microsecond)
+	since := now.Add(-firstDigestWindow)
+	if *sinceFlag != "" {
+		since, err = parseTimeOrAgo(*sinceFlag, now)
+		if err != nil {
+			return fmt.Errorf("invalid --since: %w", err)
+		}
+	} else if user.LastDigestAt.Valid {
+		since = user.LastDigestAt.Time
+	}
+	d, err := buildDigest(s, user, since, now, int32(*limit))
+	if err != nil {
+		return err
+	}
+
+	if !*send && *file == "" {
+		// A preview, which does not count as the user's last digest
+		if s.output != outputText {
+			records := []digestPostRecord{}
+			for _, feed := range d.Feeds {
+				for _, post := range feed.Posts {
+					records = append(records, digestPostRecord{
+						Feed:        feed.Name,
+						PostID:      post.PostID,
+						Title:       post.Title,
+						URL:         post.URL,
+						PublishedAt: post.PublishedAt,
+						Summary:     post.Summary,
+					})
+				}
+			}
+			return s.render(records)
+		}
+		return page(d.Text())
+	}
+
+	var messages []string
+	if *file != "" {
+		content := d.Text()
+		if ext := strings.ToLower(filepath.Ext(*file)); ext == ".html" || ext == ".htm" {
+			if content, err = d.HTML(); err != nil {
+				return fmt.Errorf("failed to render digest: %w", err)
+			}
+		}
+		if err := os.WriteFile(*file, []byte(content), 0o644); err != nil {
+			return fmt.Errorf("failed to write digest: %w", err)
+		}
+		messages = append(messages, fmt.Sprintf("Wrote a digest of %d %s to %s", d.Posts, plural(d.Posts, "post"), *file))
+	}
+	if *send {
+		if d.Posts == 0 {
+			messages = append(messages, fmt.Sprintf("No new posts since %s, no email sent", since.Local().Format(digestTimeFormat)))
+		} else {
+			if err := mailDigest(s.config, user.Email.String, d); err != nil {
+				return err
+			}
+			messages = append(messages, fmt.Sprintf("Sent a digest of %d %s to %s", d.Posts, plural(d.Posts, "post"), user.Email.String))
+		}
+	}
+	if *sinceFlag == "" {
+		// The next digest starts where this one ended. If a scheduled digest
+		// went out meanwhile, leave its time alone.
+		swapParams := database.SwapLastDigestAtParams{
+			ID:           user.ID,
+			LastDigestAt: NewNullTime(now),
+			Previous:     user.LastDigestAt,
+		}
+		if _, err := s.queries.SwapLastDigestAt(context.Background(), swapParams); err != nil {
+			return fmt.Errorf("failed to record digest: %w", err)
+		}
+	}
+
+	if s.output != outputText {
+		records := make([]messageRecord, 0, len(messages))
+		for _, message := range messages {
+			records = append(records, messageRecord{Message: message})
+		}
+		return s.render(records)
+	}
+	for _, message := range messages {
+		fmt.Println(message)
+	}
+	return nil
+}
+
+func HandlePrune(s *state) error {
+	fs := flag.NewFlagSet("prune", flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "count the posts that would be pruned without deleting them")
+	batchSize := fs.Int("batch-size", defaultPruneBatchSize, "posts deleted per statement")
+	if _, err := parseArgs(fs, s.args); err != nil {
+		return err
+	}
+	if *batchSize <= 0 {
+		return errors.New("--batch-size must be positive")
+	}
+
+	var result pruneResult
+	if *dryRun {
+		countParams := database.CountExpiredPostsParams{
+			Now:                  time.Now(),
+			DefaultMaxAgeSeconds: s.retention.maxAgeSeconds(),
+			DefaultMaxPosts:      int32(s.retention.maxPosts),
+		}
+		count, err := s.queries.CountExpiredPosts(context.Background(), countParams)
+		if err != nil {
+			return fmt.Errorf("failed to count expired posts: %w", err)
+		}
+		result.posts = count
+	} else {
+		var err error
+		result, err = prunePosts(context.Background(), s, int32(*batchSize))
+		if err != nil {
+			return err
+		}
+	}
+
+	if s.output != outputText {
+		return s.render(pruneRecord{Posts: result.posts, Tombstones: result.tombstones, DryRun: *dryRun})
+	}
+	if *dryRun {
+		fmt.Printf("%d %s would be pruned\n", result.posts, plural(int(result.posts), "post"))
+		return nil
+	}
+	fmt.Printf("Pruned %d %s\n", result.posts, plural(int(result.posts), "post"))
+	return nil
+}
+
+func HandleRetention(s *state) error {
+	fs := flag.NewFlagSet("retention", flag.ContinueOnError)
+	maxAge := fs.String("max-age", "", "delete posts published longer ago than this, e.g. 90d; 0 for no limit, or default")
+	maxPosts := fs.String("max-posts", "", "keep at most this many posts; 0 for no limit, or default")
+	args, err := parseArgs(fs, s.args)
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		if *maxAge != "" || *maxPosts != "" {
+			return errors.New("feed URL or name is required; set the default policy in ~/.gatorconfig.json")
+		}
+		return retentionList(s)
+	}
+	feed, err := resolveFeed(s, args[0])
+	if err != nil {
+		return err
+	}
+
+	if *maxAge != "" || *maxPosts != "" {
+		retentionParams := database.SetFeedRetentionParams{
+			ID:                     feed.ID,
+			RetentionMaxAgeSeconds: feed.RetentionMaxAgeSeconds,
+			RetentionMaxPosts:      feed.RetentionMaxPosts,
+			UpdatedAt:              time.Now(),
+		}
+		switch *maxAge {
+		case "":
+		case "default":
+			retentionParams.RetentionMaxAgeSeconds = sql.NullInt32{}
+		default:
+			d, err := parseAge(*maxAge)
+			if err != nil || d < 0 || d.Seconds() > math.MaxInt32 {
+				return fmt.Errorf("invalid --max-age %s", *maxAge)
+			}
+			retentionParams.RetentionMaxAgeSeconds = sql.NullInt32{Int32: int32(d.Seconds()), Valid: true}
+		}
+		switch *maxPosts {
+		case "":
+		case "default":
+			retentionParams.RetentionMaxPosts = sql.NullInt32{}
+		default:
+			n, err := strconv.ParseInt(*maxPosts, 10, 32)
+			if err != nil || n < 0 {
+				return fmt.Errorf("invalid --max-posts %s", *maxPosts)
+			}
+			retentionParams.RetentionMaxPosts = sql.NullInt32{Int32: int32(n), Valid: true}
+		}
+		if err := s.queries.SetFeedRetention(context.Background(), retentionParams); err != nil {
+			return fmt.Errorf("failed to set retention policy: %w", err)
+		}
+		feed.RetentionMaxAgeSeconds = retentionParams.RetentionMaxAgeSeconds
+		feed.RetentionMaxPosts = retentionParams.RetentionMaxPosts
+	}
+
+	record := feedRetention(s, feed)
+	if s.output != outputText {
+		return s.render(record)
+	}
+	fmt.Printf("%s: %s\n", feed.Name, describeRetentionRecord(record))
+	return nil
+}
+
+func retentionList(s *state) error {
+	feeds, err := s.queries.GetAllFeeds(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to get feeds: %w", err)
+	}
+	records := []retentionRecord{{
+		MaxAgeSeconds: int64(s.retention.maxAgeSeconds()),
+		MaxPosts:      int64(s.retention.maxPosts),
+		Default:       true,
+	}}
+	for _, feed := range feeds {
+		if feed.RetentionMaxAgeSeconds.Valid || feed.RetentionMaxPosts.Valid {
+			records = append(records, feedRetention(s, feed))
+		}
+	}
+	if s.output != outputText {
+		return s.render(records)
+	}
+	fmt.Printf("Default: %s\n", describeRetentionRecord(records[0]))
+	for _, record := range records[1:] {
+		fmt.Printf("%s: %s\n", *record.Feed, describeRetentionRecord(record))
+	}
+	return nil
+}
+
+// feedRetention is the retention policy that applies to a feed, falling back
+// to the default for any limit the feed does not set.
+func feedRetention(s *state, feed database.Feed) retentionRecord {
+	record := retentionRecord{
+		Feed:          &feed.Name,
+		MaxAgeSeconds: int64(s.retention.maxAgeSeconds()),
+		MaxPosts:      int64(s.retention.maxPosts),
+		Default:       !feed.RetentionMaxAgeSeconds.Valid && !feed.RetentionMaxPosts.Valid,
+	}
+	if feed.RetentionMaxAgeSeconds.Valid {
+		record.MaxAgeSeconds = int64(feed.RetentionMaxAgeSeconds.Int32)
+	}
+	if feed.RetentionMaxPosts.Valid {
+		record.MaxPosts = int64(feed.RetentionMaxPosts.Int32)
+	}
+	return record
+}
+
+func describeRetentionRecord(record retentionRecord) string {
+	description := describeRetention(time.Duration(record.MaxAgeSeconds)*time.Second, int(record.MaxPosts))
+	if record.Default && record.Feed != nil {
+		description += " (the default)"
+	}
+	return description
+}
@@ -2,8 +2,10 @@ package config
 
 import (
 	"encoding/json"
+	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 )
 
 const configFileName = ".gatorconfig.json"
@@ -11,8 +13,31 @@ const configFileName = ".gatorconfig.json"
 type Config struct {
 	DBURL           string `json:"db_url"`
 	CurrentUserName string `json:"current_user_name"`
+	LogLevel        string `json:"log_level,omitempty"`  // debug, info, warn or error; defaults to info
+	LogFormat       string `json:"log_format,omitempty"` // text or json; defaults to text
+	LogFile         string `json:"log_file,omitempty"`   // path to append logs to; defaults to stderr
+
+	FetchLogEntries int    `json:"fetch_log_entries,omitempty"` // fetch history kept per feed; defaults to 100
+	MinFeedInterval string `json:"min_feed_interval,omitempty"` // shortest learned polling interval, e.g. "10m"
+	MaxFeedInterval string `json:"max_feed_interval,omitempty"` // longest learned polling interval, e.g. "24h"
+
+	// Default retention policy, which feeds can override; unset keeps posts forever
+	RetentionMaxAge   string `json:"retention_max_age,omitempty"`   // delete posts published longer ago than this, e.g. "90d"
+	RetentionMaxPosts int    `json:"retention_max_posts,omitempty"` // keep at most this many posts per feed
+
+	// SMTP server that digests are sent through
+	SMTPHost     string `json:"smtp_host,omitempty"`
+	SMTPPort     int    `json:"smtp_port,omitempty"` // defaults to 587
+	SMTPUsername string `json:"smtp_username,omitempty"`
+	SMTPPassword string `json:"smtp_password,omitempty"`
+	SMTPFrom     string `json:"smtp_from,omitempty"` // sender address of digests
 }
 
+const (
+	defaultFetchLogEntries = 100
+	defaultSMTPPort        = 587
+)
+
 func getConfigPath() (string, error) {
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
@@ -75,3 +100,23 @@ func (c *Config) ClearUser() error {
 	c.CurrentUserName = ""
 	return write(c)
 }
+
+// FetchLogRetention is the number of fetch history entries kept per feed.
+func (c *Config) FetchLogRetention() int {
+	if c.FetchLogEntries <= 0 {
+		return defaultFetchLogEntries
+	}
+	return c.FetchLogEntries
+}
+
+// SMTPAddr is the host:port of the SMTP server, or "" if none is configured.
+func (c *Config) SMTPAddr() string {
+	if c.SMTPHost == "" {
+		return ""
+	}
+	port := c.SMTPPort
+	if port <= 0 {
+		port = defaultSMTPPort
+	}
+	return net.JoinHostPort(c.SMTPHost, strconv.Itoa(port))
+}
@@ -66,17 +66,32 @@ func (q *Queries) CreateFeedFollow(ctx context.Context, arg CreateFeedFollowPara
 }
 
 const getFeedFollowsForUser = `-- name: GetFeedFollowsForUser :many
-SELECT feeds.name as feed_name, users.name AS user_name
+SELECT feeds.id AS feed_id, feeds.name as feed_name, users.name AS user_name,
+       unread.unread_count, unread.muted_count
 FROM feed_follows
 JOIN feeds ON feed_follows.feed_id = feeds.id
 JOIN users ON feed_follows.user_id = users.id
+CROSS JOIN LATERAL (
+    SELECT COUNT(*) FILTER (WHERE NOT mute.muted) AS unread_count,
+           COUNT(*) FILTER (WHERE mute.muted) AS muted_count
+    FROM posts
+    CROSS JOIN LATERAL (SELECT post_muted(feed_follows.user_id, posts) AS muted) mute
+    WHERE posts.feed_id = feeds.id
+      AND NOT EXISTS (
+          SELECT 1 FROM post_reads
+          WHERE post_reads.post_id = posts.id AND post_reads.user_id = feed_follows.user_id
+      )
+) unread
 WHERE feed_follows.user_id = $1
 ORDER BY feed_follows.created_at DESC
 `
 
 type GetFeedFollowsForUserRow struct {
-	FeedName string
-	UserName string
+	FeedID      uuid.UUID
+	FeedName    string
+	UserName    string
+	UnreadCount int64
+	MutedCount  int64
 }
 
 func (q *Queries) GetFeedFollowsForUser(ctx context.Context, userID uuid.UUID) ([]GetFeedFollowsForUserRow, error) {
@@ -88,7 +103,13 @@ func (q *Queries) GetFeedFollowsForUser(ctx context.Context, userID uuid.UUID) (
 	var items []GetFeedFollowsForUserRow
 	for rows.Next() {
 		var i GetFeedFollowsForUserRow
-		if err := rows.Scan(&i.FeedName, &i.UserName); err != nil {
+		if err := rows.Scan(
+			&i.FeedID,
+			&i.FeedName,
+			&i.UserName,
+			&i.UnreadCount,
+			&i.MutedCount,
+		); err != nil {
 			return nil, err
 		}
 		items = append(items, i)
@@ -116,3 +137,45 @@ func (q *Queries) UnfollowFeed(ctx context.Context, arg UnfollowFeedParams) erro
 	_, err := q.db.ExecContext(ctx, unfollowFeed, arg.FeedID, arg.UserID)
 	return err
 }
+
+const getFollowedFeedsForUser = `-- name: GetFollowedFeedsForUser :many
+SELECT feeds.id, feeds.created_at, feeds.updated_at, feeds.name, feeds.url, feeds.user_id, feeds.last_fetched_at, feeds.fetch_interval_seconds, feeds.retention_max_age_seconds, feeds.retention_max_posts
+FROM feeds
+JOIN feed_follows ON feed_follows.feed_id = feeds.id
+WHERE feed_follows.user_id = $1
+ORDER BY feeds.last_fetched_at ASC NULLS FIRST
+`
+
+func (q *Queries) GetFollowedFeedsForUser(ctx context.Context, userID uuid.UUID) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getFollowedFeedsForUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.FetchIntervalSeconds,
+			&i.RetentionMaxAgeSeconds,
+			&i.RetentionMaxPosts,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -10,7 +10,7 @@ import (
 )
 
 const getUserByName = `-- name: GetUserByName :one
-select id, created_at, updated_at, name from users where name = $1
+select id, created_at, updated_at, name, last_active_at, email, last_digest_at from users where name = $1
 `
 
 func (q *Queries) GetUserByName(ctx context.Context, name string) (User, error) {
@@ -21,12 +21,15 @@ func (q *Queries) GetUserByName(ctx context.Context, name string) (User, error)
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Name,
+		&i.LastActiveAt,
+		&i.Email,
+		&i.LastDigestAt,
 	)
 	return i, err
 }
 
 const getUsers = `-- name: GetUsers :many
-select id, created_at, updated_at, name from users
+select id, created_at, updated_at, name, last_active_at, email, last_digest_at from users
 `
 
 func (q *Queries) GetUsers(ctx context.Context) ([]User, error) {
@@ -43,6 +46,9 @@ func (q *Queries) GetUsers(ctx context.Context) ([]User, error) {
 			&i.CreatedAt,
 			&i.UpdatedAt,
 			&i.Name,
+			&i.LastActiveAt,
+			&i.Email,
+			&i.LastDigestAt,
 		); err != nil {
 			return nil, err
 		}
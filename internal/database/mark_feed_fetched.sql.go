@@ -8,19 +8,138 @@ package database
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
 
+const countDueFeeds = `-- name: CountDueFeeds :one
+SELECT COUNT(*) FILTER (WHERE (feeds.last_fetched_at IS NULL
+       OR feeds.last_fetched_at + make_interval(secs => COALESCE(feeds.fetch_interval_seconds::float8, $1::float8 / priority.weight)) <= NOW())) AS due,
+       COUNT(*) FILTER (WHERE feeds.last_fetched_at IS NULL OR feeds.last_fetched_at < $3) AS overdue
+FROM feeds
+CROSS JOIN LATERAL (
+    SELECT COUNT(*) AS followers,
+           COUNT(*) FILTER (WHERE users.last_active_at > NOW() - INTERVAL '7 days') AS active_followers
+    FROM feed_follows
+    JOIN users ON users.id = feed_follows.user_id
+    WHERE feed_follows.feed_id = feeds.id
+) follow_stats
+CROSS JOIN LATERAL (
+    SELECT CASE WHEN follow_stats.followers = 0 THEN 0.25::float8
+                ELSE 1 + ln(follow_stats.followers::float8) + ln(1 + follow_stats.active_followers::float8)
+           END AS weight
+) priority
+WHERE follow_stats.followers > 0 OR $2::bool
+`
+
+type CountDueFeedsParams struct {
+	BaseIntervalSeconds float64
+	IncludeUnfollowed   bool
+	OverdueBefore       time.Time
+}
+
+type CountDueFeedsRow struct {
+	Due     int64
+	Overdue int64
+}
+
+func (q *Queries) CountDueFeeds(ctx context.Context, arg CountDueFeedsParams) (CountDueFeedsRow, error) {
+	row := q.db.QueryRowContext(ctx, countDueFeeds, arg.BaseIntervalSeconds, arg.IncludeUnfollowed, arg.OverdueBefore)
+	var i CountDueFeedsRow
+	err := row.Scan(&i.Due, &i.Overdue)
+	return i, err
+}
+
+const getDueFeeds = `-- name: GetDueFeeds :many
+SELECT feeds.id, feeds.created_at, feeds.updated_at, feeds.name, feeds.url, feeds.user_id, feeds.last_fetched_at, feeds.fetch_interval_seconds, feeds.retention_max_age_seconds, feeds.retention_max_posts
+FROM feeds
+CROSS JOIN LATERAL (
+    SELECT COUNT(*) AS followers,
+           COUNT(*) FILTER (WHERE users.last_active_at > NOW() - INTERVAL '7 days') AS active_followers
+    FROM feed_follows
+    JOIN users ON users.id = feed_follows.user_id
+    WHERE feed_follows.feed_id = feeds.id
+) follow_stats
+CROSS JOIN LATERAL (
+    SELECT CASE WHEN follow_stats.followers = 0 THEN 0.25::float8
+                ELSE 1 + ln(follow_stats.followers::float8) + ln(1 + follow_stats.active_followers::float8)
+           END AS weight
+) priority
+WHERE (follow_stats.followers > 0 OR $2::bool)
+  AND (feeds.last_fetched_at IS NULL
+       OR feeds.last_fetched_at + make_interval(secs => COALESCE(feeds.fetch_interval_seconds::float8, $1::float8 / priority.weight)) <= NOW())
+ORDER BY feeds.last_fetched_at + make_interval(secs => COALESCE(feeds.fetch_interval_seconds::float8, $1::float8 / priority.weight)) ASC NULLS FIRST
+`
+
+type GetDueFeedsParams struct {
+	BaseIntervalSeconds float64
+	IncludeUnfollowed   bool
+}
+
+func (q *Queries) GetDueFeeds(ctx context.Context, arg GetDueFeedsParams) ([]Feed, error) {
+	rows, err := q.db.QueryContext(ctx, getDueFeeds, arg.BaseIntervalSeconds, arg.IncludeUnfollowed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Feed
+	for rows.Next() {
+		var i Feed
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Name,
+			&i.Url,
+			&i.UserID,
+			&i.LastFetchedAt,
+			&i.FetchIntervalSeconds,
+			&i.RetentionMaxAgeSeconds,
+			&i.RetentionMaxPosts,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const getNextFeedToFetch = `-- name: GetNextFeedToFetch :one
-SELECT id, created_at, updated_at, name, url, user_id, last_fetched_at FROM feeds
-WHERE last_fetched_at IS NULL OR last_fetched_at < NOW()
-ORDER BY last_fetched_at ASC NULLS FIRST
+SELECT feeds.id, feeds.created_at, feeds.updated_at, feeds.name, feeds.url, feeds.user_id, feeds.last_fetched_at, feeds.fetch_interval_seconds, feeds.retention_max_age_seconds, feeds.retention_max_posts
+FROM feeds
+CROSS JOIN LATERAL (
+    SELECT COUNT(*) AS followers,
+           COUNT(*) FILTER (WHERE users.last_active_at > NOW() - INTERVAL '7 days') AS active_followers
+    FROM feed_follows
+    JOIN users ON users.id = feed_follows.user_id
+    WHERE feed_follows.feed_id = feeds.id
+) follow_stats
+CROSS JOIN LATERAL (
+    SELECT CASE WHEN follow_stats.followers = 0 THEN 0.25::float8
+                ELSE 1 + ln(follow_stats.followers::float8) + ln(1 + follow_stats.active_followers::float8)
+           END AS weight
+) priority
+WHERE (follow_stats.followers > 0 OR $2::bool)
+  AND (feeds.last_fetched_at IS NULL
+       OR feeds.last_fetched_at + make_interval(secs => COALESCE(feeds.fetch_interval_seconds::float8, $1::float8 / priority.weight)) <= NOW())
+ORDER BY feeds.last_fetched_at + make_interval(secs => COALESCE(feeds.fetch_interval_seconds::float8, $1::float8 / priority.weight)) ASC NULLS FIRST
 LIMIT 1
 `
 
-func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
-	row := q.db.QueryRowContext(ctx, getNextFeedToFetch)
+type GetNextFeedToFetchParams struct {
+	BaseIntervalSeconds float64
+	IncludeUnfollowed   bool
+}
+
+func (q *Queries) GetNextFeedToFetch(ctx context.Context, arg GetNextFeedToFetchParams) (Feed, error) {
+	row := q.db.QueryRowContext(ctx, getNextFeedToFetch, arg.BaseIntervalSeconds, arg.IncludeUnfollowed)
 	var i Feed
 	err := row.Scan(
 		&i.ID,
@@ -30,6 +149,9 @@ func (q *Queries) GetNextFeedToFetch(ctx context.Context) (Feed, error) {
 		&i.Url,
 		&i.UserID,
 		&i.LastFetchedAt,
+		&i.FetchIntervalSeconds,
+		&i.RetentionMaxAgeSeconds,
+		&i.RetentionMaxPosts,
 	)
 	return i, err
 }
@@ -50,3 +172,19 @@ func (q *Queries) MarkFeedFetched(ctx context.Context, arg MarkFeedFetchedParams
 	_, err := q.db.ExecContext(ctx, markFeedFetched, arg.LastFetchedAt, arg.ID)
 	return err
 }
+
+const setFeedFetchInterval = `-- name: SetFeedFetchInterval :exec
+UPDATE feeds
+SET fetch_interval_seconds = $1
+WHERE id = $2
+`
+
+type SetFeedFetchIntervalParams struct {
+	FetchIntervalSeconds sql.NullInt32
+	ID                   uuid.UUID
+}
+
+func (q *Queries) SetFeedFetchInterval(ctx context.Context, arg SetFeedFetchIntervalParams) error {
+	_, err := q.db.ExecContext(ctx, setFeedFetchInterval, arg.FetchIntervalSeconds, arg.ID)
+	return err
+}
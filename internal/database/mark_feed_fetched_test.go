@@ -0,0 +1,109 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Follower weights speed up feeds that are still on the default interval, but
+// a learned interval was already bounded by the feed's ttl and the schedule's
+// minimum and maximum, so it must be kept as is.
+func TestDueFeedsKeepLearnedIntervals(t *testing.T) {
+	_, q := openTestDB(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	var readers []User
+	for _, name := range []string{"ann", "bob", "cat"} {
+		user := testUser(t, q, name)
+		if err := q.TouchUser(ctx, TouchUserParams{LastActiveAt: sql.NullTime{Time: now, Valid: true}, Name: name}); err != nil {
+			t.Fatalf("failed to touch user: %v", err)
+		}
+		readers = append(readers, user)
+	}
+	popularFeed := func(name string, interval time.Duration, fetchedAgo time.Duration) Feed {
+		feed := testFeed(t, q, readers[0], name)
+		for _, user := range readers {
+			testFollow(t, q, user, feed)
+		}
+		if interval > 0 {
+			setInterval(t, q, feed, interval)
+		}
+		markFetched(t, q, feed, now.Add(-fetchedAgo))
+		return feed
+	}
+
+	// A 3h ttl, fetched an hour ago by three active readers
+	ttlFeed := popularFeed("ttl", 3*time.Hour, time.Hour)
+	// Learned at the 10m minimum, fetched 5m ago
+	minFeed := popularFeed("min", 10*time.Minute, 5*time.Minute)
+	// Still on the 1h default, which three active readers shorten
+	defaultFeed := popularFeed("default", 0, 30*time.Minute)
+	// Nobody follows it; learned at the 24h maximum and fetched 25h ago
+	archived := testFeed(t, q, readers[0], "archived")
+	setInterval(t, q, archived, 24*time.Hour)
+	markFetched(t, q, archived, now.Add(-25*time.Hour))
+
+	feeds, err := q.GetDueFeeds(ctx, GetDueFeedsParams{
+		BaseIntervalSeconds: time.Hour.Seconds(),
+		IncludeUnfollowed:   true,
+	})
+	if err != nil {
+		t.Fatalf("GetDueFeeds failed: %v", err)
+	}
+	due := map[uuid.UUID]bool{}
+	for _, feed := range feeds {
+		due[feed.ID] = true
+	}
+	for _, tt := range []struct {
+		feed Feed
+		want bool
+	}{
+		{ttlFeed, false},
+		{minFeed, false},
+		{defaultFeed, true},
+		{archived, true},
+	} {
+		if due[tt.feed.ID] != tt.want {
+			t.Errorf("feed %s due = %v, want %v", tt.feed.Name, due[tt.feed.ID], tt.want)
+		}
+	}
+
+	counts, err := q.CountDueFeeds(ctx, CountDueFeedsParams{
+		BaseIntervalSeconds: time.Hour.Seconds(),
+		IncludeUnfollowed:   true,
+		OverdueBefore:       now.Add(-48 * time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("CountDueFeeds failed: %v", err)
+	}
+	if counts.Due != 2 {
+		t.Errorf("CountDueFeeds due = %d, want 2", counts.Due)
+	}
+}
+
+func setInterval(t *testing.T, q *Queries, feed Feed, interval time.Duration) {
+	t.Helper()
+	err := q.SetFeedFetchInterval(context.Background(), SetFeedFetchIntervalParams{
+		FetchIntervalSeconds: sql.NullInt32{Int32: int32(interval.Seconds()), Valid: true},
+		ID:                   feed.ID,
+	})
+	if err != nil {
+		t.Fatalf("failed to set fetch interval: %v", err)
+	}
+}
+
+func markFetched(t *testing.T, q *Queries, feed Feed, at time.Time) {
+	t.Helper()
+	err := q.MarkFeedFetched(context.Background(), MarkFeedFetchedParams{
+		LastFetchedAt: sql.NullTime{Time: at, Valid: true},
+		ID:            feed.ID,
+	})
+	if err != nil {
+		t.Fatalf("failed to mark feed fetched: %v", err)
+	}
+}
@@ -11,14 +11,48 @@ import (
 	"github.com/google/uuid"
 )
 
+type AlertDelivery struct {
+	RuleID      int64
+	PostID      uuid.UUID
+	DeliveredAt time.Time
+	Error       sql.NullString
+}
+
+type AlertRule struct {
+	ID         int64
+	UserID     uuid.UUID
+	FeedID     uuid.NullUUID
+	Kind       string
+	Pattern    string
+	Command    sql.NullString
+	WebhookUrl sql.NullString
+	CreatedAt  time.Time
+}
+
 type Feed struct {
-	ID            uuid.UUID
-	CreatedAt     time.Time
-	UpdatedAt     time.Time
-	Name          string
-	Url           string
-	UserID        uuid.UUID
-	LastFetchedAt sql.NullTime
+	ID                     uuid.UUID
+	CreatedAt              time.Time
+	UpdatedAt              time.Time
+	Name                   string
+	Url                    string
+	UserID                 uuid.UUID
+	LastFetchedAt          sql.NullTime
+	FetchIntervalSeconds   sql.NullInt32
+	RetentionMaxAgeSeconds sql.NullInt32
+	RetentionMaxPosts      sql.NullInt32
+}
+
+type FetchLog struct {
+	ID           uuid.UUID
+	FeedID       uuid.UUID
+	StartedAt    time.Time
+	DurationMs   int64
+	HttpStatus   sql.NullInt32
+	Bytes        int64
+	ItemsSeen    int32
+	PostsNew     int32
+	PostsUpdated int32
+	Error        sql.NullString
 }
 
 type FeedFollow struct {
@@ -29,6 +63,15 @@ type FeedFollow struct {
 	UserID    uuid.UUID
 }
 
+type MuteRule struct {
+	ID        int64
+	UserID    uuid.UUID
+	FeedID    uuid.NullUUID
+	Kind      string
+	Pattern   string
+	CreatedAt time.Time
+}
+
 type Post struct {
 	ID          uuid.UUID
 	CreatedAt   time.Time
@@ -38,11 +81,62 @@ type Post struct {
 	Description sql.NullString
 	PublishedAt time.Time
 	FeedID      uuid.UUID
+	Content     sql.NullString
+	ContentHash sql.NullString
+	ShortID     int64
+	Author      sql.NullString
+	Categories  []string
 }
 
-type User struct {
-	ID        uuid.UUID
+type PostRead struct {
+	UserID uuid.UUID
+	PostID uuid.UUID
+	ReadAt time.Time
+}
+
+type PostStar struct {
+	UserID    uuid.UUID
+	PostID    uuid.UUID
 	CreatedAt time.Time
-	UpdatedAt time.Time
+}
+
+type PostTag struct {
+	TagID     uuid.UUID
+	PostID    uuid.UUID
+	CreatedAt time.Time
+}
+
+type PostRevision struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	PostID      uuid.UUID
+	Title       string
+	Description sql.NullString
+	Content     sql.NullString
+	ContentHash string
+}
+
+type PrunedPost struct {
+	FeedID     uuid.UUID
+	Url        string
+	PrunedAt   time.Time
+	LastSeenAt time.Time
+}
+
+type Tag struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
 	Name      string
+	CreatedAt time.Time
+}
+
+type User struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+	Name         string
+	LastActiveAt sql.NullTime
+	Email        sql.NullString
+	LastDigestAt sql.NullTime
 }
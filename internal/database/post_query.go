@@ -0,0 +1,211 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// PostCursor is a position in a timeline ordered by (published_at, id).
+type PostCursor struct {
+	PublishedAt time.Time
+	ID          uuid.UUID
+}
+
+// PostFilter describes which posts ListPosts returns: those in the user's
+// followed feeds, or, when filtering by tag or star, the user's tagged or
+// starred posts wherever they came from. Zero values leave a criterion out,
+// so filters can be combined freely.
+type PostFilter struct {
+	UserID     uuid.UUID
+	UnreadOnly bool
+	FeedIDs    []uuid.UUID // any of these feeds
+	Since      time.Time   // published at or after
+	Until      time.Time   // published before
+	Keywords   []string    // each must appear in the title or description
+	Tags       []string    // the user must have tagged the post with each
+	Starred    bool        // only posts the user has starred
+	ShowMuted  bool        // include posts hidden by the user's mute rules
+	Before     *PostCursor // older than this position
+	After      *PostCursor // newer than this position, returned oldest first
+	Limit      int32
+	Offset     int32
+
+	// CollapseDuplicates lists a URL found in several posts the filter matches
+	// once, as its earliest copy, with every feed it appears in as its Sources.
+	// The group counts as read once any copy is.
+	CollapseDuplicates bool
+}
+
+type ListPostsRow struct {
+	ID          uuid.UUID
+	ShortID     int64
+	Title       string
+	Url         string
+	Description sql.NullString
+	PublishedAt time.Time
+	FeedName    string
+	FeedUrl     string
+	IsRead      bool
+	IsStarred   bool
+	Sources     []string // names of the feeds the post appears in
+}
+
+// postQuery accumulates WHERE conditions and their positional arguments.
+type postQuery struct {
+	conditions []string
+	args       []interface{}
+}
+
+// arg adds a query argument and returns its placeholder.
+func (b *postQuery) arg(v interface{}) string {
+	b.args = append(b.args, v)
+	return fmt.Sprintf("$%d", len(b.args))
+}
+
+func (b *postQuery) where(condition string) {
+	b.conditions = append(b.conditions, condition)
+}
+
+// likePattern matches s anywhere in a string with ILIKE.
+func likePattern(s string) string {
+	return "%" + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s) + "%"
+}
+
+// match adds the conditions selecting the filter's posts, apart from mute
+// rules and paging, and returns the placeholder of the user ID.
+func (b *postQuery) match(f PostFilter) (user string) {
+	user = b.arg(f.UserID)
+	b.conditions = append(b.conditions, b.filterConditions(f, "posts", user)...)
+	return user
+}
+
+// filterConditions returns the conditions match applies, for posts aliased
+// as table.
+func (b *postQuery) filterConditions(f PostFilter, table, user string) []string {
+	var conditions []string
+	if len(f.Tags) == 0 && !f.Starred {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM feed_follows WHERE feed_follows.feed_id = "+table+".feed_id AND feed_follows.user_id = "+user+")")
+	}
+	for _, tag := range f.Tags {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM post_tags JOIN tags ON tags.id = post_tags.tag_id WHERE post_tags.post_id = "+table+".id AND tags.user_id = "+user+" AND tags.name = "+b.arg(tag)+")")
+	}
+	if f.Starred {
+		conditions = append(conditions, "EXISTS (SELECT 1 FROM post_stars WHERE post_stars.post_id = "+table+".id AND post_stars.user_id = "+user+")")
+	}
+	if f.UnreadOnly {
+		conditions = append(conditions, "NOT EXISTS (SELECT 1 FROM post_reads WHERE post_reads.post_id = "+table+".id AND post_reads.user_id = "+user+")")
+	}
+	if len(f.FeedIDs) > 0 {
+		conditions = append(conditions, table+".feed_id = ANY("+b.arg(pq.Array(f.FeedIDs))+"::uuid[])")
+	}
+	if !f.Since.IsZero() {
+		conditions = append(conditions, table+".published_at >= "+b.arg(f.Since))
+	}
+	if !f.Until.IsZero() {
+		conditions = append(conditions, table+".published_at < "+b.arg(f.Until))
+	}
+	for _, keyword := range f.Keywords {
+		pattern := b.arg(likePattern(keyword))
+		conditions = append(conditions, "("+table+".title ILIKE "+pattern+" OR "+table+".description ILIKE "+pattern+")")
+	}
+	return conditions
+}
+
+func (q *Queries) ListPosts(ctx context.Context, f PostFilter) ([]ListPostsRow, error) {
+	var b postQuery
+	user := b.match(f)
+	if !f.ShowMuted {
+		b.where("NOT post_muted(" + user + ", posts)")
+	}
+	sources := "ARRAY[feeds.name]"
+	readCheck := "EXISTS (SELECT 1 FROM post_reads WHERE post_reads.post_id = posts.id AND post_reads.user_id = " + user + ")"
+	if f.CollapseDuplicates {
+		// A copy is another post with the same URL that the filter would
+		// otherwise list too, read or not. The earliest copy stands for them
+		// all, and reading any one of them reads the whole group.
+		copyFilter := f
+		copyFilter.UnreadOnly = false
+		copyConditions := append([]string{"dup.url = posts.url"}, b.filterConditions(copyFilter, "dup", user)...)
+		if !f.ShowMuted {
+			copyConditions = append(copyConditions, "NOT post_muted("+user+", dup)")
+		}
+		copyCondition := strings.Join(copyConditions, " AND ")
+		b.where("NOT EXISTS (SELECT 1 FROM posts AS dup WHERE " + copyCondition + " AND (dup.published_at, dup.id) < (posts.published_at, posts.id))")
+		sources = "ARRAY(SELECT dup_feeds.name FROM posts AS dup JOIN feeds AS dup_feeds ON dup_feeds.id = dup.feed_id WHERE " + copyCondition + " ORDER BY dup.published_at, dup.id)"
+		copyRead := "EXISTS (SELECT 1 FROM posts AS dup JOIN post_reads ON post_reads.post_id = dup.id AND post_reads.user_id = " + user + " WHERE " + copyCondition + ")"
+		if f.UnreadOnly {
+			b.where("NOT " + copyRead)
+		}
+		readCheck = "(" + readCheck + " OR " + copyRead + ")"
+	}
+	order := "DESC"
+	if f.Before != nil {
+		b.where("(posts.published_at, posts.id) < (" + b.arg(f.Before.PublishedAt) + "::timestamptz, " + b.arg(f.Before.ID) + "::uuid)")
+	}
+	if f.After != nil {
+		b.where("(posts.published_at, posts.id) > (" + b.arg(f.After.PublishedAt) + "::timestamptz, " + b.arg(f.After.ID) + "::uuid)")
+		order = "ASC"
+	}
+
+	query := `SELECT posts.id, posts.short_id, posts.title, posts.url, posts.description, posts.published_at, feeds.name AS feed_name, feeds.url AS feed_url,
+       ` + readCheck + ` AS is_read,
+       EXISTS (SELECT 1 FROM post_stars WHERE post_stars.post_id = posts.id AND post_stars.user_id = ` + user + `) AS is_starred,
+       ` + sources + ` AS sources
+FROM posts
+JOIN feeds ON posts.feed_id = feeds.id
+WHERE ` + strings.Join(b.conditions, "\n  AND ") + `
+ORDER BY posts.published_at ` + order + `, posts.id ` + order + `
+LIMIT ` + b.arg(f.Limit) + ` OFFSET ` + b.arg(f.Offset)
+
+	rows, err := q.db.QueryContext(ctx, query, b.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListPostsRow
+	for rows.Next() {
+		var i ListPostsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.ShortID,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.PublishedAt,
+			&i.FeedName,
+			&i.FeedUrl,
+			&i.IsRead,
+			&i.IsStarred,
+			pq.Array(&i.Sources),
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// CountMutedPosts counts the posts matching the filter that the user's mute
+// rules hide, across every page.
+func (q *Queries) CountMutedPosts(ctx context.Context, f PostFilter) (int64, error) {
+	var b postQuery
+	user := b.match(f)
+	b.where("post_muted(" + user + ", posts)")
+	query := `SELECT COUNT(*) FROM posts
+WHERE ` + strings.Join(b.conditions, "\n  AND ")
+	var count int64
+	err := q.db.QueryRowContext(ctx, query, b.args...).Scan(&count)
+	return count, err
+}
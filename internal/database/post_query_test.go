@@ -0,0 +1,70 @@
+package database
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestListPostsCollapsesReadDuplicates(t *testing.T) {
+	_, q := openTestDB(t)
+	ctx := context.Background()
+	user := testUser(t, q, "ann")
+	first := testFeed(t, q, user, "first")
+	second := testFeed(t, q, user, "second")
+	testFollow(t, q, user, first)
+	testFollow(t, q, user, second)
+	published := time.Now().Add(-time.Hour).Truncate(time.Second)
+	original := testPost(t, q, first, "https://example.com/story", published)
+	testPost(t, q, second, "https://example.com/story", published.Add(time.Minute))
+	testPost(t, q, second, "https://example.com/other", published)
+
+	browse := func(unreadOnly bool) []ListPostsRow {
+		t.Helper()
+		posts, err := q.ListPosts(ctx, PostFilter{
+			UserID:             user.ID,
+			UnreadOnly:         unreadOnly,
+			CollapseDuplicates: true,
+			Limit:              10,
+		})
+		if err != nil {
+			t.Fatalf("ListPosts failed: %v", err)
+		}
+		return posts
+	}
+	find := func(posts []ListPostsRow, link string) *ListPostsRow {
+		for i := range posts {
+			if posts[i].Url == link {
+				return &posts[i]
+			}
+		}
+		return nil
+	}
+
+	posts := browse(true)
+	if len(posts) != 2 {
+		t.Fatalf("listed %d unread posts, want the story once and the other post", len(posts))
+	}
+	story := find(posts, "https://example.com/story")
+	if story == nil || story.ID != original {
+		t.Fatalf("story is not listed as its earliest copy: %+v", posts)
+	}
+	if !slices.Equal(story.Sources, []string{"first", "second"}) {
+		t.Errorf("story sources = %v, want [first second]", story.Sources)
+	}
+
+	if _, err := q.MarkPostRead(ctx, MarkPostReadParams{UserID: user.ID, PostID: original, ReadAt: time.Now()}); err != nil {
+		t.Fatalf("MarkPostRead failed: %v", err)
+	}
+	posts = browse(true)
+	if len(posts) != 1 || posts[0].Url != "https://example.com/other" {
+		t.Errorf("after reading the story, unread posts = %+v, want only the other post", posts)
+	}
+
+	posts = browse(false)
+	story = find(posts, "https://example.com/story")
+	if len(posts) != 2 || story == nil || story.ID != original || !story.IsRead {
+		t.Errorf("with read posts, story = %+v, want its earliest copy marked read", story)
+	}
+}
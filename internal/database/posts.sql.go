@@ -11,8 +11,36 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const canonicalizePostURLs = `-- name: CanonicalizePostURLs :execrows
+UPDATE posts
+SET url = item.url
+FROM unnest($2::text[], $3::text[]) AS item(link, url)
+WHERE posts.feed_id = $1
+  AND posts.url = item.link
+  AND item.link <> item.url
+  AND NOT EXISTS (
+      SELECT 1 FROM posts AS existing
+      WHERE existing.feed_id = $1 AND existing.url = item.url
+  )
+`
+
+type CanonicalizePostURLsParams struct {
+	FeedID uuid.UUID
+	Links  []string
+	Urls   []string
+}
+
+func (q *Queries) CanonicalizePostURLs(ctx context.Context, arg CanonicalizePostURLsParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, canonicalizePostURLs, arg.FeedID, pq.Array(arg.Links), pq.Array(arg.Urls))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const createPost = `-- name: CreatePost :exec
 INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id)
 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
@@ -43,45 +71,119 @@ func (q *Queries) CreatePost(ctx context.Context, arg CreatePostParams) error {
 	return err
 }
 
-const getPostsForUser = `-- name: GetPostsForUser :many
-SELECT posts.title, posts.url, posts.description, posts.published_at, feeds.name AS feed_name
+const getPostByShortID = `-- name: GetPostByShortID :one
+SELECT id, created_at, updated_at, title, url, description, published_at, feed_id, content, content_hash, short_id, author, categories FROM posts
+WHERE short_id = $1
+`
+
+func (q *Queries) GetPostByShortID(ctx context.Context, shortID int64) (Post, error) {
+	row := q.db.QueryRowContext(ctx, getPostByShortID, shortID)
+	var i Post
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Title,
+		&i.Url,
+		&i.Description,
+		&i.PublishedAt,
+		&i.FeedID,
+		&i.Content,
+		&i.ContentHash,
+		&i.ShortID,
+		&i.Author,
+		pq.Array(&i.Categories),
+	)
+	return i, err
+}
+
+const getPostsByURL = `-- name: GetPostsByURL :many
+SELECT id, created_at, updated_at, title, url, description, published_at, feed_id, content, content_hash, short_id, author, categories FROM posts
+WHERE url = $1
+ORDER BY updated_at DESC
+`
+
+func (q *Queries) GetPostsByURL(ctx context.Context, url string) ([]Post, error) {
+	rows, err := q.db.QueryContext(ctx, getPostsByURL, url)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Post
+	for rows.Next() {
+		var i Post
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Title,
+			&i.Url,
+			&i.Description,
+			&i.PublishedAt,
+			&i.FeedID,
+			&i.Content,
+			&i.ContentHash,
+			&i.ShortID,
+			&i.Author,
+			pq.Array(&i.Categories),
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUpdatedPostsForUser = `-- name: GetUpdatedPostsForUser :many
+SELECT posts.short_id, posts.title, posts.url, posts.published_at, posts.updated_at, feeds.name AS feed_name,
+       (SELECT COUNT(*) FROM post_revisions WHERE post_revisions.post_id = posts.id) AS revision_count
 FROM posts
 JOIN feeds ON posts.feed_id = feeds.id
 JOIN feed_follows ON feeds.id = feed_follows.feed_id
-JOIN users ON feed_follows.user_id = users.id
-WHERE users.id = $1
-ORDER BY posts.published_at DESC
+WHERE feed_follows.user_id = $1
+  AND posts.updated_at > posts.created_at
+ORDER BY posts.updated_at DESC
 LIMIT $2
 `
 
-type GetPostsForUserParams struct {
-	ID    uuid.UUID
-	Limit int32
+type GetUpdatedPostsForUserParams struct {
+	UserID uuid.UUID
+	Limit  int32
 }
 
-type GetPostsForUserRow struct {
-	Title       string
-	Url         string
-	Description sql.NullString
-	PublishedAt time.Time
-	FeedName    string
+type GetUpdatedPostsForUserRow struct {
+	ShortID       int64
+	Title         string
+	Url           string
+	PublishedAt   time.Time
+	UpdatedAt     time.Time
+	FeedName      string
+	RevisionCount int64
 }
 
-func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams) ([]GetPostsForUserRow, error) {
-	rows, err := q.db.QueryContext(ctx, getPostsForUser, arg.ID, arg.Limit)
+func (q *Queries) GetUpdatedPostsForUser(ctx context.Context, arg GetUpdatedPostsForUserParams) ([]GetUpdatedPostsForUserRow, error) {
+	rows, err := q.db.QueryContext(ctx, getUpdatedPostsForUser, arg.UserID, arg.Limit)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetPostsForUserRow
+	var items []GetUpdatedPostsForUserRow
 	for rows.Next() {
-		var i GetPostsForUserRow
+		var i GetUpdatedPostsForUserRow
 		if err := rows.Scan(
+			&i.ShortID,
 			&i.Title,
 			&i.Url,
-			&i.Description,
 			&i.PublishedAt,
+			&i.UpdatedAt,
 			&i.FeedName,
+			&i.RevisionCount,
 		); err != nil {
 			return nil, err
 		}
@@ -95,3 +197,123 @@ func (q *Queries) GetPostsForUser(ctx context.Context, arg GetPostsForUserParams
 	}
 	return items, nil
 }
+
+const notifyNewPosts = `-- name: NotifyNewPosts :exec
+SELECT pg_notify('gator_new_posts', $1::text)
+`
+
+func (q *Queries) NotifyNewPosts(ctx context.Context, feedID string) error {
+	_, err := q.db.ExecContext(ctx, notifyNewPosts, feedID)
+	return err
+}
+
+const upsertPosts = `-- name: UpsertPosts :many
+INSERT INTO posts (id, created_at, updated_at, title, url, description, published_at, feed_id, content, content_hash, author, categories)
+SELECT item.id, $1, $1, item.title, item.url, NULLIF(item.description, ''), item.published_at, $2, NULLIF(item.content, ''), item.content_hash,
+       NULLIF(item.author, ''), string_to_array(item.categories, chr(31))
+FROM unnest($3::uuid[], $4::text[], $5::text[], $6::text[], $7::timestamptz[], $8::text[], $9::text[], $10::text[], $11::text[])
+    AS item(id, title, url, description, published_at, content, content_hash, author, categories)
+WHERE NOT EXISTS (SELECT 1 FROM pruned_posts WHERE pruned_posts.feed_id = $2 AND pruned_posts.url = item.url)
+ON CONFLICT (url, feed_id) DO UPDATE
+SET title = EXCLUDED.title,
+    description = EXCLUDED.description,
+    content = EXCLUDED.content,
+    content_hash = EXCLUDED.content_hash,
+    author = EXCLUDED.author,
+    categories = EXCLUDED.categories,
+    updated_at = CASE WHEN posts.content_hash IS NULL OR posts.content_hash = EXCLUDED.content_hash THEN posts.updated_at ELSE EXCLUDED.updated_at END
+WHERE posts.content_hash IS DISTINCT FROM EXCLUDED.content_hash
+   OR posts.author IS DISTINCT FROM EXCLUDED.author
+   OR posts.categories IS DISTINCT FROM EXCLUDED.categories
+RETURNING id, (xmax = 0) AS inserted, (updated_at = $1) AS changed
+`
+
+type UpsertPostsParams struct {
+	CreatedAt     time.Time
+	FeedID        uuid.UUID
+	Ids           []uuid.UUID
+	Titles        []string
+	Urls          []string
+	Descriptions  []string
+	PublishedAts  []time.Time
+	Contents      []string
+	ContentHashes []string
+	Authors       []string
+	Categories    []string
+}
+
+type UpsertPostsRow struct {
+	ID       uuid.UUID
+	Inserted bool
+	Changed  bool
+}
+
+func (q *Queries) UpsertPosts(ctx context.Context, arg UpsertPostsParams) ([]UpsertPostsRow, error) {
+	rows, err := q.db.QueryContext(ctx, upsertPosts,
+		arg.CreatedAt,
+		arg.FeedID,
+		pq.Array(arg.Ids),
+		pq.Array(arg.Titles),
+		pq.Array(arg.Urls),
+		pq.Array(arg.Descriptions),
+		pq.Array(arg.PublishedAts),
+		pq.Array(arg.Contents),
+		pq.Array(arg.ContentHashes),
+		pq.Array(arg.Authors),
+		pq.Array(arg.Categories),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []UpsertPostsRow
+	for rows.Next() {
+		var i UpsertPostsRow
+		if err := rows.Scan(&i.ID, &i.Inserted, &i.Changed); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getRecentPublishTimes = `-- name: GetRecentPublishTimes :many
+SELECT published_at FROM posts
+WHERE feed_id = $1
+ORDER BY published_at DESC
+LIMIT $2
+`
+
+type GetRecentPublishTimesParams struct {
+	FeedID uuid.UUID
+	Limit  int32
+}
+
+func (q *Queries) GetRecentPublishTimes(ctx context.Context, arg GetRecentPublishTimesParams) ([]time.Time, error) {
+	rows, err := q.db.QueryContext(ctx, getRecentPublishTimes, arg.FeedID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []time.Time
+	for rows.Next() {
+		var published_at time.Time
+		if err := rows.Scan(&published_at); err != nil {
+			return nil, err
+		}
+		items = append(items, published_at)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
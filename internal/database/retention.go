@@ -0,0 +1,97 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// expiredPosts is the CTE shared by CountExpiredPosts and PruneExpiredPosts.
+// It selects, feed by feed, the posts older than the feed's maximum age and
+// those past its maximum count, so each feed is read through
+// posts_feed_id_published_at_idx rather than ranking the whole posts table.
+// Starred and tagged posts are never expired.
+//
+// $1 is the current time and $2 and $3 the default maximum age in seconds
+// and maximum post count, used by feeds without their own; zero means no
+// limit.
+const expiredPosts = `expired AS (
+    SELECT doomed.id, doomed.published_at
+    FROM feeds
+    CROSS JOIN LATERAL (
+        (SELECT posts.id, posts.published_at
+         FROM posts
+         WHERE posts.feed_id = feeds.id
+           AND COALESCE(feeds.retention_max_age_seconds, $2::int) > 0
+           AND posts.published_at < $1::timestamptz - make_interval(secs => COALESCE(feeds.retention_max_age_seconds, $2::int)::float8))
+        UNION
+        (SELECT posts.id, posts.published_at
+         FROM posts
+         WHERE posts.feed_id = feeds.id
+           AND COALESCE(feeds.retention_max_posts, $3::int) > 0
+         ORDER BY posts.published_at DESC, posts.id DESC
+         OFFSET COALESCE(feeds.retention_max_posts, $3::int))
+    ) AS doomed
+    WHERE (COALESCE(feeds.retention_max_age_seconds, $2::int) > 0
+        OR COALESCE(feeds.retention_max_posts, $3::int) > 0)
+      AND NOT EXISTS (SELECT 1 FROM post_stars WHERE post_stars.post_id = doomed.id)
+      AND NOT EXISTS (SELECT 1 FROM post_tags WHERE post_tags.post_id = doomed.id)
+)`
+
+const countExpiredPosts = `-- name: CountExpiredPosts :one
+WITH ` + expiredPosts + `
+SELECT COUNT(*) FROM expired
+`
+
+type CountExpiredPostsParams struct {
+	Now                  time.Time
+	DefaultMaxAgeSeconds int32
+	DefaultMaxPosts      int32
+}
+
+// CountExpiredPosts counts the posts PruneExpiredPosts would delete, for a
+// dry run.
+func (q *Queries) CountExpiredPosts(ctx context.Context, arg CountExpiredPostsParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countExpiredPosts, arg.Now, arg.DefaultMaxAgeSeconds, arg.DefaultMaxPosts)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const pruneExpiredPosts = `-- name: PruneExpiredPosts :execrows
+WITH ` + expiredPosts + `, batch AS (
+    SELECT expired.id FROM expired
+    ORDER BY expired.published_at
+    LIMIT $4
+), deleted AS (
+    DELETE FROM posts
+    USING batch
+    WHERE posts.id = batch.id
+    RETURNING posts.feed_id, posts.url
+)
+INSERT INTO pruned_posts (feed_id, url, pruned_at, last_seen_at)
+SELECT deleted.feed_id, deleted.url, $1, $1 FROM deleted
+ON CONFLICT (feed_id, url) DO UPDATE
+SET pruned_at = EXCLUDED.pruned_at
+`
+
+type PruneExpiredPostsParams struct {
+	Now                  time.Time
+	DefaultMaxAgeSeconds int32
+	DefaultMaxPosts      int32
+	BatchSize            int32
+}
+
+// PruneExpiredPosts deletes up to BatchSize expired posts, oldest first, and
+// records a tombstone for each so the next fetch doesn't add it back.
+func (q *Queries) PruneExpiredPosts(ctx context.Context, arg PruneExpiredPostsParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, pruneExpiredPosts,
+		arg.Now,
+		arg.DefaultMaxAgeSeconds,
+		arg.DefaultMaxPosts,
+		arg.BatchSize,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// The dry run and the prune share one selection, so the count must match what
+// is deleted, feed by feed, batch after batch.
+func TestPruneExpiredPostsMatchesCount(t *testing.T) {
+	db, q := openTestDB(t)
+	ctx := context.Background()
+	now := time.Now()
+	user := testUser(t, q, "ann")
+
+	// Keeps its two newest posts; the oldest is starred so it stays too
+	capped := testFeed(t, q, user, "capped")
+	if err := q.SetFeedRetention(ctx, SetFeedRetentionParams{
+		ID:                capped.ID,
+		RetentionMaxPosts: sql.NullInt32{Int32: 2, Valid: true},
+		UpdatedAt:         now,
+	}); err != nil {
+		t.Fatalf("failed to set retention: %v", err)
+	}
+	var cappedPosts []uuid.UUID
+	for i, link := range []string{"c1", "c2", "c3", "c4", "c5"} {
+		cappedPosts = append(cappedPosts, testPost(t, q, capped, link, now.Add(-time.Duration(5-i)*time.Hour)))
+	}
+	if _, err := q.StarPost(ctx, StarPostParams{UserID: user.ID, PostID: cappedPosts[0], CreatedAt: now}); err != nil {
+		t.Fatalf("failed to star post: %v", err)
+	}
+	// Falls back to the default 30 day maximum age
+	aged := testFeed(t, q, user, "aged")
+	testPost(t, q, aged, "a1", now.Add(-40*24*time.Hour))
+	testPost(t, q, aged, "a2", now.Add(-time.Hour))
+
+	params := CountExpiredPostsParams{
+		Now:                  now,
+		DefaultMaxAgeSeconds: int32((30 * 24 * time.Hour).Seconds()),
+	}
+	count, err := q.CountExpiredPosts(ctx, params)
+	if err != nil {
+		t.Fatalf("CountExpiredPosts failed: %v", err)
+	}
+	if count != 3 {
+		t.Errorf("CountExpiredPosts = %d, want 3", count)
+	}
+
+	var pruned int64
+	for {
+		n, err := q.PruneExpiredPosts(ctx, PruneExpiredPostsParams{
+			Now:                  params.Now,
+			DefaultMaxAgeSeconds: params.DefaultMaxAgeSeconds,
+			BatchSize:            2,
+		})
+		if err != nil {
+			t.Fatalf("PruneExpiredPosts failed: %v", err)
+		}
+		pruned += n
+		if n < 2 {
+			break
+		}
+	}
+	if pruned != count {
+		t.Errorf("PruneExpiredPosts deleted %d posts, want %d", pruned, count)
+	}
+
+	remaining := map[string]bool{}
+	rows, err := db.QueryContext(ctx, "SELECT url FROM posts")
+	if err != nil {
+		t.Fatalf("failed to list posts: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			t.Fatalf("failed to scan post: %v", err)
+		}
+		remaining[url] = true
+	}
+	for _, link := range []string{"c1", "c4", "c5", "a2"} {
+		if !remaining[link] {
+			t.Errorf("post %s was pruned, want it kept", link)
+		}
+	}
+	for _, link := range []string{"c2", "c3", "a1"} {
+		if remaining[link] {
+			t.Errorf("post %s was kept, want it pruned", link)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+)
+
+// openTestDB connects to the Postgres server in GATOR_TEST_DB_URL (a
+// postgres:// URL) and migrates a fresh schema that is dropped when the test
+// ends. Tests that need Postgres are skipped without it.
+func openTestDB(t *testing.T) (*sql.DB, *Queries) {
+	t.Helper()
+	dbURL := os.Getenv("GATOR_TEST_DB_URL")
+	if dbURL == "" {
+		t.Skip("GATOR_TEST_DB_URL is not set")
+	}
+	admin, err := sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	suffix := make([]byte, 6)
+	rand.Read(suffix)
+	schema := "gator_test_" + hex.EncodeToString(suffix)
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatalf("failed to create schema: %v", err)
+	}
+	t.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		t.Fatalf("invalid GATOR_TEST_DB_URL: %v", err)
+	}
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+	db, err := sql.Open("postgres", u.String())
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrations, err := filepath.Glob("../../sql/schema/*.sql")
+	if err != nil || len(migrations) == 0 {
+		t.Fatalf("failed to find migrations: %v", err)
+	}
+	sort.Strings(migrations)
+	for _, migration := range migrations {
+		content, err := os.ReadFile(migration)
+		if err != nil {
+			t.Fatalf("failed to read migration: %v", err)
+		}
+		up, _, _ := strings.Cut(string(content), "-- +goose Down")
+		if _, err := db.Exec(up); err != nil {
+			t.Fatalf("failed to apply %s: %v", filepath.Base(migration), err)
+		}
+	}
+	return db, New(db)
+}
+
+func testUser(t *testing.T, q *Queries, name string) User {
+	t.Helper()
+	now := time.Now()
+	user, err := q.CreateUser(context.Background(), CreateUserParams{
+		ID:        uuid.New(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Name:      name,
+	})
+	if err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	return user
+}
+
+func testFeed(t *testing.T, q *Queries, owner User, name string) Feed {
+	t.Helper()
+	now := time.Now()
+	feed, err := q.CreateFeed(context.Background(), CreateFeedParams{
+		ID:        uuid.New(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		Name:      name,
+		Url:       "https://example.com/" + name + ".xml",
+		UserID:    owner.ID,
+	})
+	if err != nil {
+		t.Fatalf("failed to create feed: %v", err)
+	}
+	return feed
+}
+
+func testFollow(t *testing.T, q *Queries, user User, feed Feed) {
+	t.Helper()
+	now := time.Now()
+	_, err := q.CreateFeedFollow(context.Background(), CreateFeedFollowParams{
+		ID:        uuid.New(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		FeedID:    feed.ID,
+		UserID:    user.ID,
+	})
+	if err != nil {
+		t.Fatalf("failed to follow feed: %v", err)
+	}
+}
+
+func testPost(t *testing.T, q *Queries, feed Feed, link string, publishedAt time.Time) uuid.UUID {
+	t.Helper()
+	id := uuid.New()
+	_, err := q.UpsertPosts(context.Background(), UpsertPostsParams{
+		CreatedAt:     time.Now(),
+		FeedID:        feed.ID,
+		Ids:           []uuid.UUID{id},
+		Titles:        []string{"Post " + link},
+		Urls:          []string{link},
+		Descriptions:  []string{""},
+		PublishedAts:  []time.Time{publishedAt},
+		Contents:      []string{""},
+		ContentHashes: []string{link},
+		Authors:       []string{""},
+		Categories:    []string{""},
+	})
+	if err != nil {
+		t.Fatalf("failed to add post: %v", err)
+	}
+	return id
+}
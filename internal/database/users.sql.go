@@ -7,6 +7,7 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
@@ -20,7 +21,7 @@ VALUES (
     $3,
     $4
 )
-RETURNING id, created_at, updated_at, name
+RETURNING id, created_at, updated_at, name, last_active_at, email, last_digest_at
 `
 
 type CreateUserParams struct {
@@ -43,6 +44,42 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Name,
+		&i.LastActiveAt,
+		&i.Email,
+		&i.LastDigestAt,
 	)
 	return i, err
 }
+
+const setUserEmail = `-- name: SetUserEmail :exec
+UPDATE users
+SET email = $2, updated_at = $3
+WHERE id = $1
+`
+
+type SetUserEmailParams struct {
+	ID        uuid.UUID
+	Email     sql.NullString
+	UpdatedAt time.Time
+}
+
+func (q *Queries) SetUserEmail(ctx context.Context, arg SetUserEmailParams) error {
+	_, err := q.db.ExecContext(ctx, setUserEmail, arg.ID, arg.Email, arg.UpdatedAt)
+	return err
+}
+
+const touchUser = `-- name: TouchUser :exec
+UPDATE users
+SET last_active_at = $1
+WHERE name = $2
+`
+
+type TouchUserParams struct {
+	LastActiveAt sql.NullTime
+	Name         string
+}
+
+func (q *Queries) TouchUser(ctx context.Context, arg TouchUserParams) error {
+	_, err := q.db.ExecContext(ctx, touchUser, arg.LastActiveAt, arg.Name)
+	return err
+}
@@ -0,0 +1,86 @@
+package metrics
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// scrape fetches the registry's metrics the way Prometheus would.
+func scrape(t *testing.T, r *Registry) string {
+	t.Helper()
+	server := httptest.NewServer(r.Handler())
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("failed to scrape: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("scrape returned %s", resp.Status)
+	}
+	if got := resp.Header.Get("Content-Type"); !strings.HasPrefix(got, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q, want the text exposition format", got)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read scrape: %v", err)
+	}
+	return string(body)
+}
+
+func TestHandler(t *testing.T) {
+	r := NewRegistry()
+	posts := r.NewCounter("gator_posts_inserted_total", "Posts inserted.")
+	fetches := r.NewCounter("gator_fetches_total", "Feed fetches by status.", "status")
+	r.NewCounter("gator_untouched_total", "A labelled counter never incremented.", "status")
+	latency := r.NewHistogram("gator_fetch_duration_seconds", "Fetch latency.", []float64{1, 0.1, 0.5})
+	r.NewGaugeFunc("gator_feeds_due", "Feeds due.", func() (float64, error) { return 3, nil })
+	r.NewGaugeFunc("gator_feeds_broken", "A gauge that fails.", func() (float64, error) { return 0, errors.New("no database") })
+
+	posts.Add(2)
+	posts.Inc()
+	fetches.Inc("200")
+	fetches.Inc("200")
+	fetches.Inc(`bad "quote"`)
+	latency.Observe(0.05)
+	latency.Observe(0.3)
+	latency.Observe(2)
+
+	want := `# HELP gator_posts_inserted_total Posts inserted.
+# TYPE gator_posts_inserted_total counter
+gator_posts_inserted_total 3
+# HELP gator_fetches_total Feed fetches by status.
+# TYPE gator_fetches_total counter
+gator_fetches_total{status="200"} 2
+gator_fetches_total{status="bad \"quote\""} 1
+# HELP gator_untouched_total A labelled counter never incremented.
+# TYPE gator_untouched_total counter
+# HELP gator_fetch_duration_seconds Fetch latency.
+# TYPE gator_fetch_duration_seconds histogram
+gator_fetch_duration_seconds_bucket{le="0.1"} 1
+gator_fetch_duration_seconds_bucket{le="0.5"} 2
+gator_fetch_duration_seconds_bucket{le="1"} 2
+gator_fetch_duration_seconds_bucket{le="+Inf"} 3
+gator_fetch_duration_seconds_sum 2.35
+gator_fetch_duration_seconds_count 3
+# HELP gator_feeds_due Feeds due.
+# TYPE gator_feeds_due gauge
+gator_feeds_due 3
+`
+	if got := scrape(t, r); got != want {
+		t.Errorf("scrape returned:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestUnusedCounterReportsZero(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("gator_parse_failures_total", "Feeds that failed to parse.")
+	want := "gator_parse_failures_total 0\n"
+	if got := scrape(t, r); !strings.HasSuffix(got, want) {
+		t.Errorf("scrape returned:\n%s\nwant it to end with %q", got, want)
+	}
+}
@@ -3,9 +3,14 @@ package rssfeed
 import (
 	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"html"
+	"io"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -14,21 +19,72 @@ type RSSFeed struct {
 		Title       string    `xml:"title"`
 		Link        string    `xml:"link"`
 		Description string    `xml:"description"`
+		TTL         string    `xml:"ttl"` // Minutes the feed may be cached for, see CacheTTL
 		Items       []RSSItem `xml:"item"`
 	} `xml:"channel"`
 }
 
 type RSSItem struct {
-	Title       string `xml:"title"`
-	Link        string `xml:"link"`
-	Description string `xml:"description"`
-	PubDate     string `xml:"pubDate"`
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description"`
+	Content     string   `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	PubDate     string   `xml:"pubDate"`
+	Author      string   `xml:"author"`
+	Creator     string   `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Categories  []string `xml:"category"`
 }
 
-func FetchRSSFeed(ctx context.Context, url string) (*RSSFeed, error) {
+// CacheTTL returns how long the feed asks to be cached for, or zero if it
+// does not say. Publishers write all sorts in <ttl>, such as 1.5 or 60 min,
+// so a leading number of minutes is taken and anything else is ignored.
+func (feed *RSSFeed) CacheTTL() time.Duration {
+	fields := strings.Fields(feed.Channel.TTL)
+	if len(fields) == 0 {
+		return 0
+	}
+	minutes, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil || !(minutes > 0 && minutes <= float64(math.MaxInt64/time.Minute)) {
+		return 0
+	}
+	return time.Duration(minutes * float64(time.Minute))
+}
+
+// AuthorName returns who wrote the item, preferring the Dublin Core creator
+// (usually a name) over the RSS author (usually an email address).
+func (item RSSItem) AuthorName() string {
+	if creator := strings.TrimSpace(item.Creator); creator != "" {
+		return creator
+	}
+	return strings.TrimSpace(item.Author)
+}
+
+// ErrDecode is returned when a feed was downloaded but could not be parsed.
+var ErrDecode = errors.New("failed to decode RSS feed")
+
+// FetchInfo describes the HTTP exchange behind a fetch. It is filled in as far
+// as the fetch got, so it is meaningful even when an error is returned.
+type FetchInfo struct {
+	StatusCode int
+	Bytes      int64
+}
+
+type countingReader struct {
+	r io.Reader
+	n *int64
+}
+
+func (c countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	*c.n += int64(n)
+	return n, err
+}
+
+func FetchRSSFeed(ctx context.Context, url string) (*RSSFeed, FetchInfo, error) {
+	var info FetchInfo
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, info, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("User-Agent", "gator")
 	client := &http.Client{
@@ -36,20 +92,22 @@ func FetchRSSFeed(ctx context.Context, url string) (*RSSFeed, error) {
 	}
 	resp, err := client.Do(req)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch RSS feed: %w", err)
+		return nil, info, fmt.Errorf("failed to fetch RSS feed: %w", err)
 	}
 	defer resp.Body.Close()
+	info.StatusCode = resp.StatusCode
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, info, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
 	var feed RSSFeed
-	if err := xml.NewDecoder(resp.Body).Decode(&feed); err != nil {
-		return nil, fmt.Errorf("failed to decode RSS feed: %w", err)
+	body := countingReader{r: resp.Body, n: &info.Bytes}
+	if err := xml.NewDecoder(body).Decode(&feed); err != nil {
+		return nil, info, fmt.Errorf("%w: %w", ErrDecode, err)
 	}
 
-	return &feed, nil
+	return &feed, info, nil
 }
 
 func (feed *RSSFeed) UnescapeTitleandDescription() {
@@ -58,5 +116,6 @@ func (feed *RSSFeed) UnescapeTitleandDescription() {
 	for i := range feed.Channel.Items {
 		feed.Channel.Items[i].Title = html.UnescapeString(feed.Channel.Items[i].Title)
 		feed.Channel.Items[i].Description = html.UnescapeString(feed.Channel.Items[i].Description)
+		feed.Channel.Items[i].Content = html.UnescapeString(feed.Channel.Items[i].Content)
 	}
 }
@@ -0,0 +1,53 @@
+package rssfeed
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCacheTTL(t *testing.T) {
+	tests := []struct {
+		ttl  string
+		want time.Duration
+	}{
+		{"", 0},
+		{"60", time.Hour},
+		{" 15\n", 15 * time.Minute},
+		{"1.5", 90 * time.Second},
+		{"60 min", time.Hour},
+		{"0", 0},
+		{"-5", 0},
+		{"soon", 0},
+		{"NaN", 0},
+		{"Inf", 0},
+		{"1e300", 0},
+	}
+	for _, tt := range tests {
+		var feed RSSFeed
+		feed.Channel.TTL = tt.ttl
+		if got := feed.CacheTTL(); got != tt.want {
+			t.Errorf("CacheTTL() with <ttl>%s</ttl> = %s, want %s", tt.ttl, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeKeepsItemsWithBadTTL(t *testing.T) {
+	const doc = `<rss version="2.0"><channel>
+<title>Example</title>
+<ttl>60 min</ttl>
+<item><title>First</title><link>https://example.com/1</link></item>
+<item><title>Second</title><link>https://example.com/2</link></item>
+</channel></rss>`
+	var feed RSSFeed
+	if err := xml.NewDecoder(strings.NewReader(doc)).Decode(&feed); err != nil {
+		t.Fatalf("failed to decode feed: %v", err)
+	}
+	if len(feed.Channel.Items) != 2 {
+		t.Errorf("decoded %d items, want 2", len(feed.Channel.Items))
+	}
+	if got := feed.CacheTTL(); got != time.Hour {
+		t.Errorf("CacheTTL() = %s, want 1h", got)
+	}
+}
@@ -0,0 +1,114 @@
+// Package urlnorm canonicalizes links so that the same article reached
+// through different feeds, or with different tracking parameters, has the
+// same URL.
+package urlnorm
+
+import (
+	"net/url"
+	"strings"
+)
+
+// trackingParams are query parameters that identify where a click came from
+// rather than what it points to. Names ending in * are prefixes.
+var trackingParams = []string{
+	"utm_*",
+	"fbclid",
+	"gclid",
+	"dclid",
+	"msclkid",
+	"yclid",
+	"igshid",
+	"mc_cid",
+	"mc_eid",
+	"_hsenc",
+	"_hsmi",
+	"mkt_tok",
+}
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// Canonicalize returns the canonical form of an http or https link:
+//   - the scheme and host are lowercased
+//   - the port is dropped when it is the scheme's default
+//   - tracking parameters such as utm_source are removed, along with an
+//     empty query or fragment
+//   - a trailing slash is removed from the path, and an empty path becomes /
+//
+// The rest of the link, including the order of the remaining query
+// parameters, is kept as is. Links that do not parse or are not http or
+// https are returned unchanged.
+func Canonicalize(link string) string {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return link
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Opaque != "" {
+		return link
+	}
+
+	host, port := u.Hostname(), u.Port()
+	host = strings.ToLower(host)
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]" // IPv6
+	}
+	if port != "" && port != defaultPorts[u.Scheme] {
+		host += ":" + port
+	}
+	u.Host = host
+
+	if u.RawQuery != "" {
+		u.RawQuery = stripTracking(u.RawQuery)
+	}
+	u.ForceQuery = false
+	if u.Fragment == "" {
+		u.RawFragment = ""
+	}
+
+	if u.Path == "" {
+		u.Path = "/"
+		u.RawPath = ""
+	} else if len(u.Path) > 1 && strings.HasSuffix(u.Path, "/") {
+		u.Path = strings.TrimRight(u.Path, "/")
+		if u.Path == "" {
+			u.Path = "/"
+		}
+		u.RawPath = strings.TrimRight(u.RawPath, "/")
+	}
+	return u.String()
+}
+
+// stripTracking removes tracking parameters from a raw query, leaving the
+// others exactly as they were written.
+func stripTracking(rawQuery string) string {
+	var kept []string
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param == "" {
+			continue
+		}
+		name, _, _ := strings.Cut(param, "=")
+		if decoded, err := url.QueryUnescape(name); err == nil {
+			name = decoded
+		}
+		if !isTracking(strings.ToLower(name)) {
+			kept = append(kept, param)
+		}
+	}
+	return strings.Join(kept, "&")
+}
+
+func isTracking(name string) bool {
+	for _, tracking := range trackingParams {
+		if prefix, ok := strings.CutSuffix(tracking, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == tracking {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package urlnorm
+
+import "testing"
+
+func TestCanonicalize(t *testing.T) {
+	tests := []struct {
+		name string
+		link string
+		want string
+	}{
+		{"already canonical", "https://example.com/posts/1", "https://example.com/posts/1"},
+		{"lowercases scheme and host", "HTTPS://Example.COM/Posts/1", "https://example.com/Posts/1"},
+		{"trims whitespace", "  https://example.com/a \n", "https://example.com/a"},
+		{"empty path", "https://example.com", "https://example.com/"},
+		{"root path", "https://example.com/", "https://example.com/"},
+		{"trailing slash", "https://example.com/posts/1/", "https://example.com/posts/1"},
+		{"several trailing slashes", "https://example.com/posts//", "https://example.com/posts"},
+		{"default http port", "http://example.com:80/a", "http://example.com/a"},
+		{"default https port", "https://example.com:443/a", "https://example.com/a"},
+		{"other scheme's default port", "https://example.com:80/a", "https://example.com:80/a"},
+		{"custom port", "http://example.com:8080/a", "http://example.com:8080/a"},
+		{"ipv6 host", "http://[2001:DB8::1]/a", "http://[2001:db8::1]/a"},
+		{"ipv6 default port", "http://[2001:db8::1]:80/a", "http://[2001:db8::1]/a"},
+		{"ipv6 custom port", "https://[::1]:8443/a", "https://[::1]:8443/a"},
+		{"utm parameters", "https://example.com/a?utm_source=rss&utm_medium=feed", "https://example.com/a"},
+		{"utm prefix only", "https://example.com/a?utm=1&utm_whatever=2", "https://example.com/a?utm=1"},
+		{"tracking parameters", "https://example.com/a?fbclid=x&gclid=y&mc_cid=z", "https://example.com/a"},
+		{"tracking parameter case", "https://example.com/a?UTM_Source=rss&FBCLID=x", "https://example.com/a"},
+		{"escaped tracking name", "https://example.com/a?utm%5Fsource=rss", "https://example.com/a"},
+		{"keeps other parameters in order", "https://example.com/a?b=2&utm_source=rss&a=1", "https://example.com/a?b=2&a=1"},
+		{"keeps parameter encoding", "https://example.com/a?q=a%20b+c&utm_campaign=x", "https://example.com/a?q=a%20b+c"},
+		{"empty query", "https://example.com/a?", "https://example.com/a"},
+		{"empty parameters", "https://example.com/a?&&x=1&", "https://example.com/a?x=1"},
+		{"empty fragment", "https://example.com/a#", "https://example.com/a"},
+		{"keeps fragment", "https://example.com/a#section-2", "https://example.com/a#section-2"},
+		{"keeps escaped path", "https://example.com/a%2Fb/", "https://example.com/a%2Fb"},
+		{"keeps escaped path without slash", "https://example.com/a%2Fb", "https://example.com/a%2Fb"},
+		{"keeps userinfo", "https://user@example.com/a", "https://user@example.com/a"},
+		{"not http", "ftp://example.com/a/", "ftp://example.com/a/"},
+		{"mailto", "mailto:someone@example.com", "mailto:someone@example.com"},
+		{"relative", "/posts/1/", "/posts/1/"},
+		{"no host", "https:///a/", "https:///a/"},
+		{"unparseable", "http://example.com/%zz", "http://example.com/%zz"},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Canonicalize(tt.link); got != tt.want {
+				t.Errorf("Canonicalize(%q) = %q, want %q", tt.link, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeIsIdempotent(t *testing.T) {
+	links := []string{
+		"HTTP://Example.com:80/a/?utm_source=x&b=1#",
+		"https://[::1]:443/",
+		"https://example.com/a%2Fb/?q=a%20b",
+	}
+	for _, link := range links {
+		once := Canonicalize(link)
+		if twice := Canonicalize(once); twice != once {
+			t.Errorf("Canonicalize(%q) = %q, but canonicalizing that gives %q", link, once, twice)
+		}
+	}
+}
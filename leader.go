@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// aggregatorLockID is the Postgres advisory lock key held by the leading
+// aggregator ("gator" in ASCII).
+const aggregatorLockID int64 = 0x6761746f72
+
+// leaderLock holds the aggregator advisory lock on a dedicated connection.
+// Postgres releases session locks when the connection ends, so if the leader
+// dies a standby can take over.
+type leaderLock struct {
+	db   *sql.DB
+	conn *sql.Conn
+}
+
+// tryAcquire attempts to take the lock without blocking.
+func (l *leaderLock) tryAcquire(ctx context.Context) (bool, error) {
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to open lock connection: %w", err)
+	}
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", aggregatorLockID).Scan(&acquired); err != nil {
+		conn.Close()
+		return false, fmt.Errorf("failed to try advisory lock: %w", err)
+	}
+	if !acquired {
+		conn.Close()
+		return false, nil
+	}
+	l.conn = conn
+	return true, nil
+}
+
+// held reports whether the lock is still held, which it stops being if the
+// connection holding it has been lost.
+func (l *leaderLock) held(ctx context.Context) bool {
+	if l.conn == nil {
+		return false
+	}
+	if err := l.conn.PingContext(ctx); err != nil {
+		l.conn.Close()
+		l.conn = nil
+		return false
+	}
+	return true
+}
+
+// wait blocks as a standby until the lock is acquired or ctx is cancelled.
+func (l *leaderLock) wait(ctx context.Context, s *state, retry time.Duration) error {
+	announced := false
+	for {
+		acquired, err := l.tryAcquire(ctx)
+		if err != nil {
+			s.logger.Error("failed to check aggregator leadership", "error", err)
+		} else if acquired {
+			s.logger.Info("acquired aggregator leadership")
+			return nil
+		} else if !announced {
+			s.logger.Warn("another aggregator already holds leadership, waiting as standby", "retry", retry)
+			announced = true
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(retry):
+		}
+	}
+}
+
+func (l *leaderLock) release() {
+	if l.conn == nil {
+		return
+	}
+	l.conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", aggregatorLockID)
+	l.conn.Close()
+	l.conn = nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/tbirddv/gator/internal/config"
+)
+
+// newLogger builds the logger described by the log settings in the config.
+// The returned closer releases the log file, if one was opened.
+func newLogger(cfg *config.Config) (*slog.Logger, io.Closer, error) {
+	var level slog.Level
+	if cfg.LogLevel != "" {
+		if err := level.UnmarshalText([]byte(cfg.LogLevel)); err != nil {
+			return nil, nil, fmt.Errorf("invalid log level %q: %w", cfg.LogLevel, err)
+		}
+	}
+
+	var out io.WriteCloser = nopCloser{os.Stderr}
+	if cfg.LogFile != "" && cfg.LogFile != "stderr" {
+		file, err := os.OpenFile(cfg.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		out = file
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch strings.ToLower(cfg.LogFormat) {
+	case "", "text":
+		handler = slog.NewTextHandler(out, opts)
+	case "json":
+		handler = slog.NewJSONHandler(out, opts)
+	default:
+		out.Close()
+		return nil, nil, fmt.Errorf("invalid log format %q, expected text or json", cfg.LogFormat)
+	}
+	return slog.New(handler), out, nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
@@ -2,9 +2,12 @@ package main
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"strings"
+	"time"
 
 	_ "github.com/lib/pq" // Importing pq for PostgreSQL driver
 	"github.com/tbirddv/gator/internal/config"
@@ -12,45 +15,133 @@ import (
 )
 
 type state struct {
-	config  *config.Config
-	queries *database.Queries
-	args    []string
+	config    *config.Config
+	db        *sql.DB
+	queries   *database.Queries
+	logger    *slog.Logger
+	metrics   *scrapeMetrics
+	schedule  schedule
+	retention retentionPolicy
+	alerts    *alertQueue
+	output    outputFormat
+	args      []string
+}
+
+// schedule controls which feeds the aggregator considers due, and when it
+// sends digests and prunes posts.
+type schedule struct {
+	// feedInterval is how often a feed with a single inactive follower is
+	// fetched until its own interval has been learned; feeds with more, or
+	// more active, followers are fetched sooner.
+	feedInterval time.Duration
+	// archiveUnfollowed keeps fetching feeds nobody follows, at a quarter of
+	// the base rate.
+	archiveUnfollowed bool
+	// minFeedInterval and maxFeedInterval bound the interval learned from
+	// each feed's posting cadence, which replaces feedInterval once known.
+	minFeedInterval time.Duration
+	maxFeedInterval time.Duration
+	// digestInterval, if set, is how often each user with an email address
+	// is sent a digest of new posts.
+	digestInterval time.Duration
+	// pruneInterval, if set, is how often expired posts are pruned, next at
+	// nextPrune.
+	pruneInterval time.Duration
+	nextPrune     time.Time
+}
+
+var defaultSchedule = schedule{
+	feedInterval:    time.Hour,
+	minFeedInterval: 10 * time.Minute,
+	maxFeedInterval: 24 * time.Hour,
+}
+
+// newSchedule applies any scheduling settings in the config to the defaults.
+func newSchedule(cfg *config.Config) (schedule, error) {
+	sched := defaultSchedule
+	if cfg.MinFeedInterval != "" {
+		d, err := time.ParseDuration(cfg.MinFeedInterval)
+		if err != nil {
+			return sched, fmt.Errorf("invalid min_feed_interval: %w", err)
+		}
+		sched.minFeedInterval = d
+	}
+	if cfg.MaxFeedInterval != "" {
+		d, err := time.ParseDuration(cfg.MaxFeedInterval)
+		if err != nil {
+			return sched, fmt.Errorf("invalid max_feed_interval: %w", err)
+		}
+		sched.maxFeedInterval = d
+	}
+	if sched.minFeedInterval > sched.maxFeedInterval {
+		return sched, errors.New("min_feed_interval is longer than max_feed_interval")
+	}
+	return sched, nil
 }
 
 func main() {
 	configData, err := config.Read()
 	if err != nil {
-		fmt.Println("Error reading config:", err)
-		return
+		slog.Error("failed to read config", "error", err)
+		os.Exit(1)
 	}
-	if len(os.Args) < 2 {
-		fmt.Println("No command provided")
+	logger, logFile, err := newLogger(configData)
+	if err != nil {
+		slog.Error("failed to set up logging", "error", err)
+		os.Exit(1)
+	}
+	defer logFile.Close()
+	sched, err := newSchedule(configData)
+	if err != nil {
+		logger.Error("invalid config", "error", err)
+		os.Exit(1)
+	}
+	retention, err := newRetentionPolicy(configData)
+	if err != nil {
+		logger.Error("invalid config", "error", err)
+		os.Exit(1)
+	}
+	output, cliArgs, err := extractOutputFlag(os.Args[1:])
+	if err != nil {
+		logger.Error("invalid arguments", "error", err)
+		os.Exit(1)
+	}
+	if len(cliArgs) < 1 {
+		logger.Error("no command provided")
 		os.Exit(1)
 	}
 	db, err := sql.Open("postgres", configData.DBURL)
 	if err != nil {
-		fmt.Println("Error connecting to database:", err)
-		return
+		logger.Error("failed to connect to database", "error", err)
+		os.Exit(1)
 	}
 	defer db.Close()
 	queries := database.New(db)
-	command := strings.ToLower(os.Args[1])
-	args := make([]string, 0)
-	if len(os.Args) > 2 {
-		args = os.Args[2:]
-	}
+	command := strings.ToLower(cliArgs[0])
+	args := cliArgs[1:]
 	state := &state{
-		config:  configData,
-		queries: queries,
-		args:    args,
+		config:    configData,
+		db:        db,
+		queries:   queries,
+		logger:    logger,
+		metrics:   newScrapeMetrics(),
+		schedule:  sched,
+		retention: retention,
+		output:    output,
+		args:      args,
 	}
+	state.alerts = newAlertQueue(state)
 	commands := CommandInit(state)
-	if command, exists := commands[command]; exists {
-		err = command.Execute()
+	if cmd, exists := commands[command]; exists {
+		err = cmd.Execute()
+		state.alerts.wait()
 		if err != nil {
-			fmt.Println("Error executing command:", err)
+			logger.Error("command failed", "command", command, "error", err)
 			os.Exit(1)
 		}
+		if cmd.Activity {
+			touchCurrentUser(state)
+		}
 	} else {
 		fmt.Println("Unknown command:", command)
 		fmt.Println("Available commands:")
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/tbirddv/gator/internal/database"
+	"github.com/tbirddv/gator/internal/metrics"
+)
+
+// scrapeMetrics instruments scrapeFeed. It is always recorded, but only
+// served when agg is started with --metrics-addr.
+type scrapeMetrics struct {
+	registry          *metrics.Registry
+	fetches           *metrics.Counter
+	fetchDuration     *metrics.Histogram
+	bytesDownloaded   *metrics.Counter
+	itemsParsed       *metrics.Counter
+	postsInserted     *metrics.Counter
+	postsUpdated      *metrics.Counter
+	duplicatesSkipped *metrics.Counter
+	parseFailures     *metrics.Counter
+	alerts            *metrics.Counter
+	digests           *metrics.Counter
+	postsPruned       *metrics.Counter
+}
+
+func newScrapeMetrics() *scrapeMetrics {
+	r := metrics.NewRegistry()
+	return &scrapeMetrics{
+		registry:          r,
+		fetches:           r.NewCounter("gator_feed_fetches_total", "Feed fetches by HTTP status, or \"error\" when no response was received.", "status"),
+		fetchDuration:     r.NewHistogram("gator_feed_fetch_duration_seconds", "Time taken to download and parse a feed.", []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}),
+		bytesDownloaded:   r.NewCounter("gator_feed_bytes_downloaded_total", "Bytes of feed bodies downloaded."),
+		itemsParsed:       r.NewCounter("gator_feed_items_parsed_total", "Items parsed from fetched feeds."),
+		postsInserted:     r.NewCounter("gator_posts_inserted_total", "New posts stored."),
+		postsUpdated:      r.NewCounter("gator_posts_updated_total", "Existing posts updated after an edit by their publisher."),
+		duplicatesSkipped: r.NewCounter("gator_posts_duplicates_skipped_total", "Fetched items that were already stored unchanged."),
+		parseFailures:     r.NewCounter("gator_feed_parse_failures_total", "Feeds that could not be decoded, and items with an unparseable date.", "kind"),
+		alerts:            r.NewCounter("gator_alerts_total", "Alerts sent for new posts, by whether every hook succeeded.", "result"),
+		digests:           r.NewCounter("gator_digests_total", "Scheduled email digests, by whether they were sent.", "result"),
+		postsPruned:       r.NewCounter("gator_posts_pruned_total", "Posts deleted by the retention policy."),
+	}
+}
+
+// registerFeedGauges adds gauges for the number of feeds waiting to be
+// fetched, queried from the database on every scrape of the endpoint.
+func (m *scrapeMetrics) registerFeedGauges(s *state, overdueAfter time.Duration) {
+	countDue := func() (database.CountDueFeedsRow, error) {
+		return s.queries.CountDueFeeds(context.Background(), database.CountDueFeedsParams{
+			BaseIntervalSeconds: s.schedule.feedInterval.Seconds(),
+			IncludeUnfollowed:   s.schedule.archiveUnfollowed,
+			OverdueBefore:       time.Now().Add(-overdueAfter),
+		})
+	}
+	m.registry.NewGaugeFunc("gator_feeds_due", "Feeds due to be fetched.", func() (float64, error) {
+		counts, err := countDue()
+		return float64(counts.Due), err
+	})
+	m.registry.NewGaugeFunc("gator_feeds_overdue", "Feeds that have not been fetched within the overdue threshold.", func() (float64, error) {
+		counts, err := countDue()
+		return float64(counts.Overdue), err
+	})
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// outputFormat selects how commands print their results. Every format other
+// than outputText writes records whose field names are part of gator's
+// interface, so scripts can rely on them.
+type outputFormat string
+
+const (
+	outputText  outputFormat = "" // human-readable text, the default
+	outputTable outputFormat = "table"
+	outputJSON  outputFormat = "json"
+	outputCSV   outputFormat = "csv"
+	outputTSV   outputFormat = "tsv"
+)
+
+// extractOutputFlag removes a global --output flag from anywhere before a
+// "--" in args and returns the format it selects.
+func extractOutputFlag(args []string) (outputFormat, []string, error) {
+	format := outputText
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+		name, value, hasValue := strings.Cut(arg, "=")
+		if name != "--output" && name != "-output" {
+			rest = append(rest, arg)
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return format, nil, fmt.Errorf("%s requires a format: json, csv, tsv or table", name)
+			}
+			i++
+			value = args[i]
+		}
+		switch f := outputFormat(strings.ToLower(value)); f {
+		case outputTable, outputJSON, outputCSV, outputTSV:
+			format = f
+		default:
+			return format, nil, fmt.Errorf("unknown output format %s, use json, csv, tsv or table", value)
+		}
+	}
+	return format, rest, nil
+}
+
+// render prints records, a struct or a slice of structs, in the selected
+// output format. Field names come from the records' json tags.
+func (s *state) render(records any) error {
+	return writeRecords(os.Stdout, s.output, records)
+}
+
+func writeRecords(w io.Writer, format outputFormat, records any) error {
+	v := reflect.ValueOf(records)
+	if format == outputJSON {
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			// An empty listing is [], not null
+			records = reflect.MakeSlice(v.Type(), 0, 0).Interface()
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(records)
+	}
+
+	if v.Kind() != reflect.Slice {
+		v = reflect.Append(reflect.MakeSlice(reflect.SliceOf(v.Type()), 0, 1), v)
+	}
+	recordType := v.Type().Elem()
+	var header []string
+	var fields []int
+	for i := range recordType.NumField() {
+		name, _, _ := strings.Cut(recordType.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		header = append(header, name)
+		fields = append(fields, i)
+	}
+	rows := make([][]string, v.Len())
+	for i := range rows {
+		rows[i] = make([]string, len(fields))
+		for j, field := range fields {
+			rows[i][j] = formatField(v.Index(i).Field(field))
+		}
+	}
+
+	switch format {
+	case outputCSV:
+		cw := csv.NewWriter(w)
+		cw.Write(header)
+		cw.WriteAll(rows)
+		return cw.Error()
+	case outputTSV:
+		for _, row := range append([][]string{header}, rows...) {
+			for i := range row {
+				row[i] = strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(row[i])
+			}
+			if _, err := fmt.Fprintln(w, strings.Join(row, "\t")); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(header, "\t")))
+		for _, row := range rows {
+			for i := range row {
+				row[i] = strings.Join(strings.Fields(row[i]), " ")
+			}
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	}
+}
+
+// formatField renders a record field as a single CSV, TSV or table cell.
+func formatField(v reflect.Value) string {
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	switch value := v.Interface().(type) {
+	case time.Time:
+		return value.Format(time.RFC3339)
+	case []string:
+		return strings.Join(value, ", ")
+	case fmt.Stringer:
+		return value.String()
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// nullString returns nil for an empty string, so it is null in JSON.
+func nullString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+// The records below are what each command prints in a machine-readable
+// format. Renaming a json tag breaks scripts, so only ever add fields.
+
+type commandRecord struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type userRecord struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	Current   bool      `json:"current"`
+}
+
+type messageRecord struct {
+	Message string `json:"message"`
+}
+
+type feedRecord struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	User string `json:"user"`
+}
+
+type followRecord struct {
+	User      string `json:"user"`
+	Feed      string `json:"feed"`
+	Following bool   `json:"following"`
+}
+
+type followingRecord struct {
+	Feed   string `json:"feed"`
+	Unread int64  `json:"unread"`
+	Muted  int64  `json:"muted"`
+}
+
+type fetchRecord struct {
+	Feed         string  `json:"feed"`
+	URL          string  `json:"url"`
+	HTTPStatus   *int    `json:"http_status"`
+	ItemsSeen    int     `json:"items_seen"`
+	PostsNew     int     `json:"posts_new"`
+	PostsUpdated int     `json:"posts_updated"`
+	Error        *string `json:"error"`
+}
+
+type fetchLogRecord struct {
+	StartedAt    time.Time `json:"started_at"`
+	DurationMs   int64     `json:"duration_ms"`
+	HTTPStatus   *int32    `json:"http_status"`
+	Bytes        int64     `json:"bytes"`
+	ItemsSeen    int32     `json:"items_seen"`
+	PostsNew     int32     `json:"posts_new"`
+	PostsUpdated int32     `json:"posts_updated"`
+	Error        *string   `json:"error"`
+}
+
+type markedRecord struct {
+	Marked int64 `json:"marked"`
+}
+
+type postRecord struct {
+	PostID      int64     `json:"post_id"`
+	Title       string    `json:"title"`
+	URL         string    `json:"url"`
+	Feed        string    `json:"feed"`
+	PublishedAt time.Time `json:"published_at"`
+	Read        bool      `json:"read"`
+	Starred     bool      `json:"starred"`
+	Cursor      string    `json:"cursor"`
+	Sources     []string  `json:"sources"`
+}
+
+type updatedPostRecord struct {
+	PostID      int64     `json:"post_id"`
+	Title       string    `json:"title"`
+	URL         string    `json:"url"`
+	Feed        string    `json:"feed"`
+	PublishedAt time.Time `json:"published_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Revisions   int64     `json:"revisions"`
+}
+
+type starredPostRecord struct {
+	PostID      int64     `json:"post_id"`
+	Title       string    `json:"title"`
+	URL         string    `json:"url"`
+	Feed        string    `json:"feed"`
+	PublishedAt time.Time `json:"published_at"`
+	StarredAt   time.Time `json:"starred_at"`
+}
+
+type searchResultRecord struct {
+	PostID      int64     `json:"post_id"`
+	Title       string    `json:"title"`
+	URL         string    `json:"url"`
+	Feed        string    `json:"feed"`
+	PublishedAt time.Time `json:"published_at"`
+	Rank        float32   `json:"rank"`
+}
+
+type starRecord struct {
+	PostID  int64  `json:"post_id"`
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	Starred bool   `json:"starred"`
+}
+
+type openedRecord struct {
+	PostID int64  `json:"post_id"`
+	URL    string `json:"url"`
+}
+
+type postTextRecord struct {
+	PostID      int64     `json:"post_id"`
+	Title       string    `json:"title"`
+	URL         string    `json:"url"`
+	PublishedAt time.Time `json:"published_at"`
+	Text        string    `json:"text"`
+}
+
+type changeRecord struct {
+	ChangedAt time.Time `json:"changed_at"`
+	Field     string    `json:"field"`
+	Diff      string    `json:"diff"`
+}
+
+type tagRecord struct {
+	Tag   string `json:"tag"`
+	Posts int64  `json:"posts"`
+}
+
+type muteRecord struct {
+	ID      int64   `json:"id"`
+	Kind    string  `json:"kind"`
+	Pattern string  `json:"pattern"`
+	Feed    *string `json:"feed"`
+}
+
+type alertRecord struct {
+	ID         int64   `json:"id"`
+	Kind       string  `json:"kind"`
+	Pattern    string  `json:"pattern"`
+	Feed       *string `json:"feed"`
+	Command    *string `json:"command"`
+	Webhook    *string `json:"webhook"`
+	Deliveries int64   `json:"deliveries"`
+}
+
+type digestPostRecord struct {
+	Feed        string    `json:"feed"`
+	PostID      int64     `json:"post_id"`
+	Title       string    `json:"title"`
+	URL         string    `json:"url"`
+	PublishedAt time.Time `json:"published_at"`
+	Summary     string    `json:"summary"`
+}
+
+type emailRecord struct {
+	User  string  `json:"user"`
+	Email *string `json:"email"`
+}
+
+type pruneRecord struct {
+	Posts      int64 `json:"posts"`
+	Tombstones int64 `json:"tombstones_dropped"`
+	DryRun     bool  `json:"dry_run"`
+}
+
+// retentionRecord is a feed's retention policy, or the default one when Feed
+// is null. Zero limits keep posts forever.
+type retentionRecord struct {
+	Feed          *string `json:"feed"`
+	MaxAgeSeconds int64   `json:"max_age_seconds"`
+	MaxPosts      int64   `json:"max_posts"`
+	Default       bool    `json:"default"`
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/tbirddv/gator/internal/config"
+	"github.com/tbirddv/gator/internal/database"
+)
+
+const (
+	defaultPruneBatchSize = 500
+	// prunedLinkRetention is how long a feed must have stopped listing a
+	// pruned post before its tombstone is dropped.
+	prunedLinkRetention = 30 * 24 * time.Hour
+)
+
+// retentionPolicy is how long posts are kept unless their feed overrides it.
+// A zero limit keeps posts forever.
+type retentionPolicy struct {
+	maxAge   time.Duration
+	maxPosts int
+}
+
+// newRetentionPolicy reads the default retention policy from the config.
+func newRetentionPolicy(cfg *config.Config) (retentionPolicy, error) {
+	var policy retentionPolicy
+	if cfg.RetentionMaxAge != "" {
+		d, err := parseAge(cfg.RetentionMaxAge)
+		if err != nil {
+			return policy, fmt.Errorf("invalid retention_max_age: %w", err)
+		}
+		if d < 0 {
+			return policy, errors.New("retention_max_age must not be negative")
+		}
+		policy.maxAge = d
+	}
+	if cfg.RetentionMaxPosts < 0 {
+		return policy, errors.New("retention_max_posts must not be negative")
+	}
+	policy.maxPosts = cfg.RetentionMaxPosts
+	return policy, nil
+}
+
+// maxAgeSeconds is the policy's maximum age as stored on feeds.
+func (p retentionPolicy) maxAgeSeconds() int32 {
+	return int32(min(p.maxAge.Seconds(), math.MaxInt32))
+}
+
+// pruneResult is what one run of the retention policy deleted.
+type pruneResult struct {
+	posts      int64
+	tombstones int64 // links of pruned posts forgotten because feeds dropped them
+}
+
+// prunePosts deletes every post the retention policy has expired, batchSize
+// posts per statement so no one statement holds locks for long. Starred and
+// tagged posts are never deleted, and each deleted post leaves a tombstone so
+// that fetching its feed again does not bring it back.
+func prunePosts(ctx context.Context, s *state, batchSize int32) (pruneResult, error) {
+	var result pruneResult
+	now := time.Now()
+	pruneParams := database.PruneExpiredPostsParams{
+		Now:                  now,
+		DefaultMaxAgeSeconds: s.retention.maxAgeSeconds(),
+		DefaultMaxPosts:      int32(s.retention.maxPosts),
+		BatchSize:            batchSize,
+	}
+	for {
+		pruned, err := s.queries.PruneExpiredPosts(ctx, pruneParams)
+		if err != nil {
+			return result, fmt.Errorf("failed to prune posts: %w", err)
+		}
+		result.posts += pruned
+		if pruned < int64(batchSize) {
+			break
+		}
+		s.logger.Debug("pruned a batch of posts", "posts", pruned)
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+	}
+
+	tombstones, err := s.queries.DeleteStalePrunedPosts(ctx, now.Add(-prunedLinkRetention))
+	if err != nil {
+		return result, fmt.Errorf("failed to forget pruned posts: %w", err)
+	}
+	result.tombstones = tombstones
+	return result, nil
+}
+
+// pruneIfDue runs the retention policy from agg once every prune interval.
+// Failures are logged so that they never stop the aggregator.
+func pruneIfDue(s *state) {
+	if s.schedule.pruneInterval <= 0 || time.Now().Before(s.schedule.nextPrune) {
+		return
+	}
+	s.schedule.nextPrune = time.Now().Add(s.schedule.pruneInterval)
+	result, err := prunePosts(context.Background(), s, defaultPruneBatchSize)
+	if err != nil {
+		s.logger.Error("failed to prune posts", "error", err)
+	}
+	if result.posts > 0 || result.tombstones > 0 {
+		s.metrics.postsPruned.Add(float64(result.posts))
+		s.logger.Info("pruned posts", "posts", result.posts, "tombstones_dropped", result.tombstones)
+	}
+}
+
+// describeRetention formats a maximum age and post count, where zero means
+// no limit.
+func describeRetention(maxAge time.Duration, maxPosts int) string {
+	if maxAge <= 0 && maxPosts <= 0 {
+		return "keep forever"
+	}
+	var age, count string
+	if maxAge > 0 {
+		age = "posts up to " + formatAge(maxAge) + " old"
+	}
+	if maxPosts > 0 {
+		count = fmt.Sprintf("the newest %d posts", maxPosts)
+	}
+	switch {
+	case age == "":
+		return "keep " + count
+	case count == "":
+		return "keep " + age
+	default:
+		return "keep " + count + ", and only " + age
+	}
+}
+
+// formatAge formats a duration in days when it is a whole number of them.
+func formatAge(d time.Duration) string {
+	if day := 24 * time.Hour; d%day == 0 {
+		return fmt.Sprintf("%dd", d/day)
+	}
+	return d.String()
+}
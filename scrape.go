@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/tbirddv/gator/internal/database"
+	"github.com/tbirddv/gator/internal/rssfeed"
+	"github.com/tbirddv/gator/internal/urlnorm"
+)
+
+// fetchResult is what a single scrape of a feed did, as far as it got.
+type fetchResult struct {
+	status       int
+	bytes        int64
+	itemsSeen    int
+	postsNew     int
+	postsUpdated int
+	ttl          time.Duration // how long the feed asks to be cached for
+}
+
+// scrapeFeeds fetches the next feed that is due, if any.
+func scrapeFeeds(s *state) error {
+	nextParams := database.GetNextFeedToFetchParams{
+		BaseIntervalSeconds: s.schedule.feedInterval.Seconds(),
+		IncludeUnfollowed:   s.schedule.archiveUnfollowed,
+	}
+	feed, err := s.queries.GetNextFeedToFetch(context.Background(), nextParams)
+	if errors.Is(err, sql.ErrNoRows) {
+		s.logger.Debug("no feeds are due")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get next feed to fetch: %w", err)
+	}
+	_, err = scrapeFeed(s, feed)
+	return err
+}
+
+// refreshFeeds scrapes each feed in turn, carrying on past failures so that one
+// broken feed does not stop the rest from being refreshed. In a
+// machine-readable output format it also prints what each scrape did.
+func refreshFeeds(s *state, feeds []database.Feed) error {
+	if len(feeds) == 0 {
+		s.logger.Info("no feeds to refresh")
+	}
+	var errs []error
+	records := make([]fetchRecord, 0, len(feeds))
+	for _, feed := range feeds {
+		result, err := scrapeFeed(s, feed)
+		record := fetchRecord{
+			Feed:         feed.Name,
+			URL:          feed.Url,
+			ItemsSeen:    result.itemsSeen,
+			PostsNew:     result.postsNew,
+			PostsUpdated: result.postsUpdated,
+		}
+		if result.status != 0 {
+			record.HTTPStatus = &result.status
+		}
+		if err != nil {
+			record.Error = nullString(err.Error())
+			errs = append(errs, fmt.Errorf("%s: %w", feed.Url, err))
+		}
+		records = append(records, record)
+	}
+	if s.output != outputText {
+		if err := s.render(records); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// scrapeFeed fetches a single feed and stores its posts, then logs the
+// attempt whether or not it succeeded.
+func scrapeFeed(s *state, feed database.Feed) (fetchResult, error) {
+	start := time.Now()
+	log := s.logger.With("feed_id", feed.ID, "url", feed.Url)
+	log.Debug("scraping feed")
+
+	result, err := fetchAndStore(s, feed, log)
+	duration := time.Since(start)
+
+	log = log.With("duration", duration, "status", result.status)
+	if err != nil {
+		log.Error("feed scrape failed", "error", err)
+	} else {
+		log.Info("feed scraped",
+			"items_seen", result.itemsSeen,
+			"items_new", result.postsNew,
+			"items_updated", result.postsUpdated,
+			"items_known", result.itemsSeen-result.postsNew-result.postsUpdated,
+		)
+	}
+
+	entry := database.CreateFetchLogParams{
+		ID:           uuid.New(),
+		FeedID:       feed.ID,
+		StartedAt:    start,
+		DurationMs:   duration.Milliseconds(),
+		HttpStatus:   sql.NullInt32{Int32: int32(result.status), Valid: result.status != 0},
+		Bytes:        result.bytes,
+		ItemsSeen:    int32(result.itemsSeen),
+		PostsNew:     int32(result.postsNew),
+		PostsUpdated: int32(result.postsUpdated),
+	}
+	if err != nil {
+		entry.Error = sql.NullString{String: err.Error(), Valid: true}
+	}
+	if logErr := s.queries.CreateFetchLog(context.Background(), entry); logErr != nil {
+		log.Warn("failed to record fetch history", "error", logErr)
+	}
+	pruneParams := database.PruneFetchLogParams{
+		FeedID: feed.ID,
+		Keep:   int32(s.config.FetchLogRetention()),
+	}
+	if logErr := s.queries.PruneFetchLog(context.Background(), pruneParams); logErr != nil {
+		log.Warn("failed to prune fetch history", "error", logErr)
+	}
+	if err == nil {
+		if learnErr := updateFetchInterval(s, feed, result.ttl, log); learnErr != nil {
+			log.Warn("failed to update fetch interval", "error", learnErr)
+		}
+	}
+	return result, err
+}
+
+// updateFetchInterval stores how often the feed should be polled, learned
+// from the gaps between its most recent posts.
+func updateFetchInterval(s *state, feed database.Feed, ttl time.Duration, log *slog.Logger) error {
+	timesParams := database.GetRecentPublishTimesParams{
+		FeedID: feed.ID,
+		Limit:  recentPostsForInterval,
+	}
+	published, err := s.queries.GetRecentPublishTimes(context.Background(), timesParams)
+	if err != nil {
+		return fmt.Errorf("failed to get recent posts: %w", err)
+	}
+	interval := learnFetchInterval(published, time.Now(), ttl, s.schedule)
+	if interval == 0 {
+		return nil // Not enough posts to learn from, keep using the default
+	}
+	log.Debug("learned fetch interval", "interval", interval)
+	intervalParams := database.SetFeedFetchIntervalParams{
+		FetchIntervalSeconds: sql.NullInt32{Int32: int32(interval.Seconds()), Valid: true},
+		ID:                   feed.ID,
+	}
+	return s.queries.SetFeedFetchInterval(context.Background(), intervalParams)
+}
+
+// recentPostsForInterval is how many of a feed's latest posts are used to
+// learn its posting cadence.
+const recentPostsForInterval = 10
+
+// learnFetchInterval picks a polling interval from the publish times of a
+// feed's recent posts, newest first: the median gap between posts, stretched
+// if the feed has since gone quiet for longer than that. The result is at
+// least the feed's declared ttl and within the schedule's bounds. It returns
+// zero when there are too few posts to tell.
+func learnFetchInterval(published []time.Time, now time.Time, ttl time.Duration, sched schedule) time.Duration {
+	if len(published) < 2 {
+		return 0
+	}
+	gaps := make([]time.Duration, 0, len(published)-1)
+	for i := 1; i < len(published); i++ {
+		gaps = append(gaps, published[i-1].Sub(published[i]))
+	}
+	slices.Sort(gaps)
+	interval := gaps[len(gaps)/2]
+
+	// A feed that has not posted for a while is unlikely to post again soon
+	interval = max(interval, now.Sub(published[0])/2)
+	interval = max(interval, ttl)
+	return min(max(interval, sched.minFeedInterval), sched.maxFeedInterval)
+}
+
+func fetchAndStore(s *state, feed database.Feed, log *slog.Logger) (fetchResult, error) {
+	var result fetchResult
+	fetchedTime := database.MarkFeedFetchedParams{
+		LastFetchedAt: NewNullTime(time.Now()),
+		ID:            feed.ID,
+	}
+
+	if err := s.queries.MarkFeedFetched(context.Background(), fetchedTime); err != nil {
+		return result, fmt.Errorf("failed to mark feed as fetched: %w", err)
+	}
+
+	start := time.Now()
+	fetchedFeed, info, err := rssfeed.FetchRSSFeed(context.Background(), feed.Url)
+	result.status = info.StatusCode
+	result.bytes = info.Bytes
+	s.metrics.fetchDuration.Observe(time.Since(start).Seconds())
+	s.metrics.bytesDownloaded.Add(float64(info.Bytes))
+	if info.StatusCode == 0 {
+		s.metrics.fetches.Inc("error")
+	} else {
+		s.metrics.fetches.Inc(strconv.Itoa(info.StatusCode))
+	}
+	if err != nil {
+		if errors.Is(err, rssfeed.ErrDecode) {
+			s.metrics.parseFailures.Inc("feed")
+		}
+		return result, fmt.Errorf("failed to fetch RSS feed: %w", err)
+	}
+	s.metrics.itemsParsed.Add(float64(len(fetchedFeed.Channel.Items)))
+	result.ttl = fetchedFeed.CacheTTL()
+
+	postParams := database.UpsertPostsParams{
+		CreatedAt: time.Now(),
+		FeedID:    feed.ID,
+	}
+	seen := make(map[string]bool)
+	var links []string // each post's link as the feed gives it
+	for _, item := range fetchedFeed.Channel.Items {
+		pubDate, err := parseFlexibleTimestamp(item.PubDate)
+		if err != nil {
+			s.metrics.parseFailures.Inc("item_date")
+			log.Warn("skipping item with invalid pubDate", "pub_date", item.PubDate, "link", item.Link)
+			continue
+		}
+		link := urlnorm.Canonicalize(item.Link)
+		if seen[link] {
+			continue // Feeds occasionally repeat an item
+		}
+		seen[link] = true
+		links = append(links, item.Link)
+		postParams.Ids = append(postParams.Ids, uuid.New())
+		postParams.Titles = append(postParams.Titles, item.Title)
+		postParams.Urls = append(postParams.Urls, link)
+		postParams.Descriptions = append(postParams.Descriptions, item.Description)
+		postParams.PublishedAts = append(postParams.PublishedAts, pubDate)
+		postParams.Contents = append(postParams.Contents, item.Content)
+		postParams.ContentHashes = append(postParams.ContentHashes, contentHash(item))
+		postParams.Authors = append(postParams.Authors, item.AuthorName())
+		// Joined with the unit separator, which UpsertPosts splits on
+		postParams.Categories = append(postParams.Categories, strings.Join(item.Categories, "\x1f"))
+	}
+	result.itemsSeen = len(postParams.Ids)
+	if len(postParams.Ids) == 0 {
+		return result, nil
+	}
+
+	tx, err := s.db.BeginTx(context.Background(), nil)
+	if err != nil {
+		return result, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	qtx := s.queries.WithTx(tx)
+
+	// Posts stored before links were canonicalized take their canonical URL,
+	// rather than being inserted again under it
+	canonicalParams := database.CanonicalizePostURLsParams{
+		FeedID: feed.ID,
+		Links:  links,
+		Urls:   postParams.Urls,
+	}
+	if _, err := qtx.CanonicalizePostURLs(context.Background(), canonicalParams); err != nil {
+		return result, fmt.Errorf("failed to canonicalize post URLs: %w", err)
+	}
+
+	// Pruned posts the feed still lists stay pruned, and their tombstones are
+	// kept for as long as the feed lists them
+	touchParams := database.TouchPrunedPostsParams{
+		FeedID:     feed.ID,
+		Urls:       postParams.Urls,
+		LastSeenAt: postParams.CreatedAt,
+	}
+	if err := qtx.TouchPrunedPosts(context.Background(), touchParams); err != nil {
+		return result, fmt.Errorf("failed to update pruned posts: %w", err)
+	}
+
+	// Keep the current version of any edited post before it is overwritten
+	revisionParams := database.CreatePostRevisionsParams{
+		CreatedAt:     postParams.CreatedAt,
+		FeedID:        feed.ID,
+		Urls:          postParams.Urls,
+		ContentHashes: postParams.ContentHashes,
+	}
+	if err := qtx.CreatePostRevisions(context.Background(), revisionParams); err != nil {
+		return result, fmt.Errorf("failed to save post revisions: %w", err)
+	}
+	upserted, err := qtx.UpsertPosts(context.Background(), postParams)
+	if err != nil {
+		return result, fmt.Errorf("failed to upsert posts: %w", err)
+	}
+	var inserted []uuid.UUID
+	for _, post := range upserted {
+		if post.Inserted {
+			result.postsNew++
+			inserted = append(inserted, post.ID)
+		} else if post.Changed {
+			result.postsUpdated++
+		}
+	}
+	if result.postsNew > 0 || result.postsUpdated > 0 {
+		// Delivered on commit to listeners such as the tui
+		if err := qtx.NotifyNewPosts(context.Background(), feed.ID.String()); err != nil {
+			return result, fmt.Errorf("failed to notify listeners: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return result, fmt.Errorf("failed to commit posts: %w", err)
+	}
+	s.metrics.postsInserted.Add(float64(result.postsNew))
+	s.metrics.postsUpdated.Add(float64(result.postsUpdated))
+	s.metrics.duplicatesSkipped.Add(float64(result.itemsSeen - result.postsNew - result.postsUpdated))
+
+	s.alerts.add(inserted, log)
+	return result, nil
+}
+
+// contentHash fingerprints the parts of an item a publisher may edit.
+func contentHash(item rssfeed.RSSItem) string {
+	sum := sha256.Sum256([]byte(item.Title + "\x00" + item.Description + "\x00" + item.Content))
+	return hex.EncodeToString(sum[:])
+}
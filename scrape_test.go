@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLearnFetchInterval(t *testing.T) {
+	now := time.Date(2026, 3, 4, 12, 0, 0, 0, time.UTC)
+	sched := schedule{minFeedInterval: 10 * time.Minute, maxFeedInterval: 24 * time.Hour}
+	// ago returns publish times the given durations before now, newest first.
+	ago := func(ds ...time.Duration) []time.Time {
+		times := make([]time.Time, len(ds))
+		for i, d := range ds {
+			times[i] = now.Add(-d)
+		}
+		return times
+	}
+	h := time.Hour
+
+	tests := []struct {
+		name      string
+		published []time.Time
+		ttl       time.Duration
+		sched     schedule
+		want      time.Duration
+	}{
+		{"no posts", nil, 0, sched, 0},
+		{"one post", ago(h), 0, sched, 0},
+		{"regular gaps", ago(0, 2*h, 4*h, 6*h), 0, sched, 2 * h},
+		{"median of odd gaps", ago(0, h, 4*h, 6*h), 0, sched, 2 * h},
+		{"median ignores a burst", ago(0, time.Minute, 2*time.Minute, 3*h+2*time.Minute, 6*h+2*time.Minute, 9*h+2*time.Minute), 0, sched, 3 * h},
+		{"median of even gaps takes the upper", ago(0, h, 3*h), 0, sched, 2 * h},
+		{"unsorted gaps", ago(0, 5*h, 6*h, 9*h, 10*h), 0, sched, 3 * h},
+		{"quiet feed stretches the interval", ago(8*h, 9*h, 10*h), 0, sched, 4 * h},
+		{"quiet for less than twice the median", ago(3*h, 5*h, 7*h), 0, sched, 2 * h},
+		{"ttl raises the interval", ago(0, h, 2*h), 3 * h, sched, 3 * h},
+		{"ttl below the median", ago(0, 2*h, 4*h), h, sched, 2 * h},
+		{"clamped to the minimum", ago(0, time.Minute, 2*time.Minute), 0, sched, 10 * time.Minute},
+		{"clamped to the maximum", ago(0, 48*h, 96*h), 0, sched, 24 * h},
+		{"ttl clamped to the maximum", ago(0, h, 2*h), 48 * h, sched, 24 * h},
+		{"long silence clamped to the maximum", ago(30*24*h, 31*24*h), 0, sched, 24 * h},
+		{"same publish times", ago(h, h, h), 0, sched, 30 * time.Minute},
+		{"equal bounds", ago(0, h, 2*h), 0, schedule{minFeedInterval: 5 * h, maxFeedInterval: 5 * h}, 5 * h},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := learnFetchInterval(tt.published, now, tt.ttl, tt.sched); got != tt.want {
+				t.Errorf("learnFetchInterval() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,426 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/tbirddv/gator/internal/database"
+)
+
+const (
+	defaultServeLimit = 50
+	maxServeLimit     = 500
+)
+
+// feedServer re-publishes each user's timeline, starred posts and tagged
+// posts as RSS 2.0, Atom and JSON Feed.
+type feedServer struct {
+	store   feedStore
+	logger  *slog.Logger
+	baseURL string // overrides the scheme and host of self links
+	limit   int32
+}
+
+// feedStore is the part of the database the feed server reads.
+type feedStore interface {
+	GetUserByName(ctx context.Context, name string) (database.User, error)
+	GetTagsForUser(ctx context.Context, userID uuid.UUID) ([]database.GetTagsForUserRow, error)
+	ListPosts(ctx context.Context, f database.PostFilter) ([]database.ListPostsRow, error)
+}
+
+// outputFeed is a list of posts ready to be written in any of the formats.
+type outputFeed struct {
+	Title       string
+	Description string
+	SelfURL     string
+	Author      string
+	Updated     time.Time
+	Posts       []database.ListPostsRow
+}
+
+// feedFormats maps each extension to its content type and writer.
+var feedFormats = map[string]struct {
+	contentType string
+	write       func(io.Writer, outputFeed) error
+}{
+	".rss":  {"application/rss+xml; charset=utf-8", writeRSS},
+	".atom": {"application/atom+xml; charset=utf-8", writeAtom},
+	".json": {"application/feed+json; charset=utf-8", writeJSONFeed},
+}
+
+func HandleServe(s *state) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	listenAddr := fs.String("listen", "localhost:8081", "address to serve feeds on")
+	baseURL := fs.String("base-url", "", "public URL of the server for self links, e.g. https://gator.example.com")
+	limit := fs.Int("limit", defaultServeLimit, "most posts in each feed")
+	if _, err := parseArgs(fs, s.args); err != nil {
+		return err
+	}
+	if *limit <= 0 || *limit > maxServeLimit {
+		return fmt.Errorf("--limit must be between 1 and %d", maxServeLimit)
+	}
+	if s.output != outputText {
+		return errors.New("serve does not print results; it logs as it runs")
+	}
+
+	fsrv := &feedServer{
+		store:   s.queries,
+		logger:  s.logger,
+		baseURL: strings.TrimSuffix(*baseURL, "/"),
+		limit:   int32(*limit),
+	}
+	server := &http.Server{
+		Addr:              *listenAddr,
+		Handler:           fsrv.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	errs := make(chan error, 1)
+	go func() {
+		s.logger.Info("serving feeds", "addr", *listenAddr)
+		errs <- server.ListenAndServe()
+	}()
+
+	var serveErr error
+	select {
+	case <-ctx.Done():
+		s.logger.Info("shutting down feed server")
+	case serveErr = <-errs:
+	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	server.Shutdown(shutdownCtx)
+	if serveErr != nil && !errors.Is(serveErr, http.ErrServerClosed) {
+		return fmt.Errorf("feed server failed: %w", serveErr)
+	}
+	return nil
+}
+
+func (fsrv *feedServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /users/{user}/{feed}", func(w http.ResponseWriter, r *http.Request) {
+		name, ext := splitExt(r.PathValue("feed"))
+		switch name {
+		case "timeline":
+			fsrv.serveFeed(w, r, ext, func(user database.User) (database.PostFilter, string, error) {
+				return database.PostFilter{CollapseDuplicates: true}, user.Name + "'s timeline", nil
+			})
+		case "starred":
+			fsrv.serveFeed(w, r, ext, func(user database.User) (database.PostFilter, string, error) {
+				return database.PostFilter{Starred: true}, user.Name + "'s starred posts", nil
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	mux.HandleFunc("GET /users/{user}/tags/{tag}", func(w http.ResponseWriter, r *http.Request) {
+		tag, ext := splitExt(r.PathValue("tag"))
+		fsrv.serveFeed(w, r, ext, func(user database.User) (database.PostFilter, string, error) {
+			tags, err := fsrv.store.GetTagsForUser(r.Context(), user.ID)
+			if err != nil {
+				return database.PostFilter{}, "", err
+			}
+			if !slices.ContainsFunc(tags, func(t database.GetTagsForUserRow) bool { return t.Name == tag }) {
+				return database.PostFilter{}, "", errNoSuchFeed
+			}
+			return database.PostFilter{Tags: []string{tag}}, fmt.Sprintf("%s's posts tagged %s", user.Name, tag), nil
+		})
+	})
+	return mux
+}
+
+var errNoSuchFeed = errors.New("no such feed")
+
+func splitExt(file string) (name, ext string) {
+	ext = path.Ext(file)
+	return strings.TrimSuffix(file, ext), ext
+}
+
+// serveFeed writes the posts selected by filter for the user named in the
+// path. Responses carry an ETag of their content, so readers polling with
+// If-None-Match get a 304 until a post is added, changed or removed.
+func (fsrv *feedServer) serveFeed(w http.ResponseWriter, r *http.Request, ext string, filter func(database.User) (database.PostFilter, string, error)) {
+	format, ok := feedFormats[ext]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	user, err := fsrv.store.GetUserByName(r.Context(), r.PathValue("user"))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		fsrv.fail(w, r, err)
+		return
+	}
+	f, title, err := filter(user)
+	if errors.Is(err, errNoSuchFeed) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		fsrv.fail(w, r, err)
+		return
+	}
+	f.UserID = user.ID
+	f.Limit = fsrv.limit
+	posts, err := fsrv.store.ListPosts(r.Context(), f)
+	if err != nil {
+		fsrv.fail(w, r, err)
+		return
+	}
+
+	feed := outputFeed{
+		Title:       "gator: " + title,
+		Description: fmt.Sprintf("The latest %d posts in %s, from gator", fsrv.limit, title),
+		SelfURL:     fsrv.selfURL(r),
+		Author:      user.Name,
+		Updated:     user.CreatedAt,
+		Posts:       posts,
+	}
+	if len(posts) > 0 {
+		feed.Updated = posts[0].PublishedAt
+	}
+	var body bytes.Buffer
+	if err := format.write(&body, feed); err != nil {
+		fsrv.fail(w, r, err)
+		return
+	}
+	sum := sha256.Sum256(body.Bytes())
+	w.Header().Set("Content-Type", format.contentType)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+	w.Header().Set("Cache-Control", "no-cache")
+	// ServeContent answers If-None-Match with a 304 and handles HEAD
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(body.Bytes()))
+}
+
+func (fsrv *feedServer) fail(w http.ResponseWriter, r *http.Request, err error) {
+	fsrv.logger.Error("failed to serve feed", "path", r.URL.Path, "error", err)
+	http.Error(w, "internal server error", http.StatusInternalServerError)
+}
+
+func (fsrv *feedServer) selfURL(r *http.Request) string {
+	base := fsrv.baseURL
+	if base == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		base = scheme + "://" + r.Host
+	}
+	return base + r.URL.EscapedPath()
+}
+
+type rssDocument struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string          `xml:"title"`
+	Link          string          `xml:"link"`
+	Description   string          `xml:"description"`
+	LastBuildDate string          `xml:"lastBuildDate"`
+	Generator     string          `xml:"generator"`
+	Self          atomLink        `xml:"atom:link"`
+	Items         []rssOutputItem `xml:"item"`
+}
+
+type rssOutputItem struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	GUID        string    `xml:"guid"`
+	PubDate     string    `xml:"pubDate"`
+	Description string    `xml:"description,omitempty"`
+	Source      rssSource `xml:"source"`
+}
+
+type rssSource struct {
+	URL  string `xml:"url,attr"`
+	Name string `xml:",chardata"`
+}
+
+func writeRSS(w io.Writer, feed outputFeed) error {
+	doc := rssDocument{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:         feed.Title,
+			Link:          feed.SelfURL,
+			Description:   feed.Description,
+			LastBuildDate: feed.Updated.UTC().Format(time.RFC1123Z),
+			Generator:     "gator",
+			Self:          atomLink{Href: feed.SelfURL, Rel: "self", Type: "application/rss+xml"},
+		},
+	}
+	for _, post := range feed.Posts {
+		doc.Channel.Items = append(doc.Channel.Items, rssOutputItem{
+			Title:       post.Title,
+			Link:        post.Url,
+			GUID:        post.Url,
+			PubDate:     post.PublishedAt.UTC().Format(time.RFC1123Z),
+			Description: post.Description.String,
+			Source:      rssSource{URL: post.FeedUrl, Name: post.FeedName},
+		})
+	}
+	return writeXML(w, doc)
+}
+
+type atomDocument struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  atomPerson  `xml:"author"`
+	Link    atomLink    `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID        string       `xml:"id"`
+	Title     string       `xml:"title"`
+	Link      atomLink     `xml:"link"`
+	Published string       `xml:"published"`
+	Updated   string       `xml:"updated"`
+	Summary   *atomSummary `xml:"summary"`
+	Source    atomSource   `xml:"source"`
+}
+
+type atomSummary struct {
+	Type string `xml:"type,attr"`
+	Text string `xml:",chardata"`
+}
+
+type atomSource struct {
+	ID    string   `xml:"id"`
+	Title string   `xml:"title"`
+	Link  atomLink `xml:"link"`
+}
+
+func writeAtom(w io.Writer, feed outputFeed) error {
+	doc := atomDocument{
+		ID:      feed.SelfURL,
+		Title:   feed.Title,
+		Updated: feed.Updated.UTC().Format(time.RFC3339),
+		Author:  atomPerson{Name: feed.Author},
+		Link:    atomLink{Href: feed.SelfURL, Rel: "self", Type: "application/atom+xml"},
+	}
+	for _, post := range feed.Posts {
+		entry := atomEntry{
+			ID:        "urn:uuid:" + post.ID.String(),
+			Title:     post.Title,
+			Link:      atomLink{Href: post.Url, Rel: "alternate"},
+			Published: post.PublishedAt.UTC().Format(time.RFC3339),
+			Updated:   post.PublishedAt.UTC().Format(time.RFC3339),
+			Source: atomSource{
+				ID:    post.FeedUrl,
+				Title: post.FeedName,
+				Link:  atomLink{Href: post.FeedUrl, Rel: "self"},
+			},
+		}
+		if post.Description.String != "" {
+			entry.Summary = &atomSummary{Type: "html", Text: post.Description.String}
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+	return writeXML(w, doc)
+}
+
+func writeXML(w io.Writer, doc any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	FeedURL     string         `json:"feed_url"`
+	Description string         `json:"description"`
+	Authors     []jsonAuthor   `json:"authors"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedItem struct {
+	ID            string         `json:"id"`
+	URL           string         `json:"url"`
+	Title         string         `json:"title"`
+	ContentHTML   string         `json:"content_html"`
+	DatePublished string         `json:"date_published"`
+	Gator         jsonFeedSource `json:"_gator"` // an extension naming the post's feed
+}
+
+type jsonFeedSource struct {
+	Feed    string `json:"feed"`
+	FeedURL string `json:"feed_url"`
+}
+
+func writeJSONFeed(w io.Writer, feed outputFeed) error {
+	doc := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       feed.Title,
+		FeedURL:     feed.SelfURL,
+		Description: feed.Description,
+		Authors:     []jsonAuthor{{Name: feed.Author}},
+		Items:       []jsonFeedItem{},
+	}
+	for _, post := range feed.Posts {
+		doc.Items = append(doc.Items, jsonFeedItem{
+			ID:            post.ID.String(),
+			URL:           post.Url,
+			Title:         post.Title,
+			ContentHTML:   post.Description.String,
+			DatePublished: post.PublishedAt.UTC().Format(time.RFC3339),
+			Gator:         jsonFeedSource{Feed: post.FeedName, FeedURL: post.FeedUrl},
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
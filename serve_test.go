@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/tbirddv/gator/internal/database"
+)
+
+// fakeFeedStore serves one user with a fixed set of posts and tags.
+type fakeFeedStore struct {
+	user    database.User
+	tags    []database.GetTagsForUserRow
+	posts   []database.ListPostsRow
+	filters []database.PostFilter
+}
+
+func (f *fakeFeedStore) GetUserByName(_ context.Context, name string) (database.User, error) {
+	if name != f.user.Name {
+		return database.User{}, sql.ErrNoRows
+	}
+	return f.user, nil
+}
+
+func (f *fakeFeedStore) GetTagsForUser(_ context.Context, userID uuid.UUID) ([]database.GetTagsForUserRow, error) {
+	return f.tags, nil
+}
+
+func (f *fakeFeedStore) ListPosts(_ context.Context, filter database.PostFilter) ([]database.ListPostsRow, error) {
+	f.filters = append(f.filters, filter)
+	return f.posts, nil
+}
+
+func newTestFeedServer(t *testing.T) (*httptest.Server, *fakeFeedStore) {
+	t.Helper()
+	published := time.Date(2026, 3, 4, 9, 30, 0, 0, time.UTC)
+	store := &fakeFeedStore{
+		user: database.User{ID: uuid.New(), Name: "ann", CreatedAt: published.Add(-time.Hour)},
+		tags: []database.GetTagsForUserRow{{Name: "golang", PostCount: 1}},
+		posts: []database.ListPostsRow{{
+			ID:          uuid.New(),
+			ShortID:     7,
+			Title:       "Generics & <iterators>",
+			Url:         "https://go.dev/blog/iter",
+			Description: sql.NullString{String: "<p>Range over functions</p>", Valid: true},
+			PublishedAt: published,
+			FeedName:    "Go Blog",
+			FeedUrl:     "https://go.dev/blog/feed.atom",
+			Sources:     []string{"Go Blog"},
+		}},
+	}
+	fsrv := &feedServer{
+		store:  store,
+		logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+		limit:  defaultServeLimit,
+	}
+	server := httptest.NewServer(fsrv.handler())
+	t.Cleanup(server.Close)
+	return server, store
+}
+
+func get(t *testing.T, url string, header http.Header) (*http.Response, string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to read response: %v", err)
+	}
+	return resp, string(body)
+}
+
+// checkRSS parses an RSS 2.0 document and checks its one item.
+func checkRSS(t *testing.T, body string) {
+	var doc struct {
+		XMLName xml.Name `xml:"rss"`
+		Version string   `xml:"version,attr"`
+		Channel struct {
+			Title string `xml:"title"`
+			Items []struct {
+				Title       string `xml:"title"`
+				Link        string `xml:"link"`
+				PubDate     string `xml:"pubDate"`
+				Description string `xml:"description"`
+				Source      struct {
+					URL  string `xml:"url,attr"`
+					Name string `xml:",chardata"`
+				} `xml:"source"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal([]byte(body), &doc); err != nil {
+		t.Fatalf("invalid RSS: %v\n%s", err, body)
+	}
+	if doc.Version != "2.0" || len(doc.Channel.Items) != 1 {
+		t.Fatalf("RSS version %q with %d items, want 2.0 with 1", doc.Version, len(doc.Channel.Items))
+	}
+	item := doc.Channel.Items[0]
+	if item.Title != "Generics & <iterators>" || item.Link != "https://go.dev/blog/iter" || item.Description != "<p>Range over functions</p>" {
+		t.Errorf("RSS item = %+v", item)
+	}
+	if _, err := time.Parse(time.RFC1123Z, item.PubDate); err != nil {
+		t.Errorf("invalid pubDate %q: %v", item.PubDate, err)
+	}
+	if item.Source.Name != "Go Blog" || item.Source.URL != "https://go.dev/blog/feed.atom" {
+		t.Errorf("RSS source = %+v", item.Source)
+	}
+}
+
+// checkAtom parses an Atom document and checks its one entry.
+func checkAtom(t *testing.T, body string) {
+	var doc struct {
+		XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		ID      string   `xml:"id"`
+		Updated string   `xml:"updated"`
+		Entries []struct {
+			ID    string `xml:"id"`
+			Title string `xml:"title"`
+			Link  struct {
+				Href string `xml:"href,attr"`
+			} `xml:"link"`
+			Updated string `xml:"updated"`
+			Summary string `xml:"summary"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal([]byte(body), &doc); err != nil {
+		t.Fatalf("invalid Atom: %v\n%s", err, body)
+	}
+	if doc.ID == "" || len(doc.Entries) != 1 {
+		t.Fatalf("Atom feed id %q with %d entries, want an id and 1 entry", doc.ID, len(doc.Entries))
+	}
+	if _, err := time.Parse(time.RFC3339, doc.Updated); err != nil {
+		t.Errorf("invalid updated %q: %v", doc.Updated, err)
+	}
+	entry := doc.Entries[0]
+	if !strings.HasPrefix(entry.ID, "urn:uuid:") || entry.Title != "Generics & <iterators>" || entry.Link.Href != "https://go.dev/blog/iter" {
+		t.Errorf("Atom entry = %+v", entry)
+	}
+	if entry.Summary != "<p>Range over functions</p>" {
+		t.Errorf("Atom summary = %q", entry.Summary)
+	}
+}
+
+// checkJSONFeed parses a JSON Feed 1.1 document and checks its one item.
+func checkJSONFeed(t *testing.T, body string) {
+	var doc struct {
+		Version string `json:"version"`
+		Title   string `json:"title"`
+		FeedURL string `json:"feed_url"`
+		Items   []struct {
+			ID            string `json:"id"`
+			URL           string `json:"url"`
+			Title         string `json:"title"`
+			ContentHTML   string `json:"content_html"`
+			DatePublished string `json:"date_published"`
+			Gator         struct {
+				Feed string `json:"feed"`
+			} `json:"_gator"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal([]byte(body), &doc); err != nil {
+		t.Fatalf("invalid JSON Feed: %v\n%s", err, body)
+	}
+	if doc.Version != "https://jsonfeed.org/version/1.1" || doc.Title == "" || len(doc.Items) != 1 {
+		t.Fatalf("JSON Feed %q titled %q with %d items", doc.Version, doc.Title, len(doc.Items))
+	}
+	item := doc.Items[0]
+	if item.ID == "" || item.URL != "https://go.dev/blog/iter" || item.ContentHTML != "<p>Range over functions</p>" || item.Gator.Feed != "Go Blog" {
+		t.Errorf("JSON Feed item = %+v", item)
+	}
+	if _, err := time.Parse(time.RFC3339, item.DatePublished); err != nil {
+		t.Errorf("invalid date_published %q: %v", item.DatePublished, err)
+	}
+}
+
+func TestServeFeeds(t *testing.T) {
+	server, store := newTestFeedServer(t)
+	formats := []struct {
+		ext         string
+		contentType string
+		check       func(*testing.T, string)
+	}{
+		{".rss", "application/rss+xml; charset=utf-8", checkRSS},
+		{".atom", "application/atom+xml; charset=utf-8", checkAtom},
+		{".json", "application/feed+json; charset=utf-8", checkJSONFeed},
+	}
+	streams := []struct {
+		path   string
+		filter func(database.PostFilter) bool
+	}{
+		{"/users/ann/timeline", func(f database.PostFilter) bool { return f.CollapseDuplicates && !f.Starred && len(f.Tags) == 0 }},
+		{"/users/ann/starred", func(f database.PostFilter) bool { return f.Starred }},
+		{"/users/ann/tags/golang", func(f database.PostFilter) bool { return len(f.Tags) == 1 && f.Tags[0] == "golang" }},
+	}
+	for _, stream := range streams {
+		for _, format := range formats {
+			path := stream.path + format.ext
+			t.Run(path, func(t *testing.T) {
+				store.filters = nil
+				resp, body := get(t, server.URL+path, nil)
+				if resp.StatusCode != http.StatusOK {
+					t.Fatalf("status = %s, want 200", resp.Status)
+				}
+				if got := resp.Header.Get("Content-Type"); got != format.contentType {
+					t.Errorf("Content-Type = %q, want %q", got, format.contentType)
+				}
+				format.check(t, body)
+				if len(store.filters) != 1 || store.filters[0].UserID != store.user.ID || !stream.filter(store.filters[0]) {
+					t.Errorf("listed posts with %+v", store.filters)
+				}
+
+				etag := resp.Header.Get("ETag")
+				if etag == "" {
+					t.Fatal("no ETag")
+				}
+				again, againBody := get(t, server.URL+path, nil)
+				if again.Header.Get("ETag") != etag || againBody != body {
+					t.Errorf("ETag changed from %s to %s for the same content", etag, again.Header.Get("ETag"))
+				}
+
+				cached, cachedBody := get(t, server.URL+path, http.Header{"If-None-Match": {etag}})
+				if cached.StatusCode != http.StatusNotModified {
+					t.Errorf("status with If-None-Match = %s, want 304", cached.Status)
+				}
+				if cachedBody != "" {
+					t.Errorf("304 response has a body: %q", cachedBody)
+				}
+				stale, _ := get(t, server.URL+path, http.Header{"If-None-Match": {`"stale"`}})
+				if stale.StatusCode != http.StatusOK {
+					t.Errorf("status with a stale ETag = %s, want 200", stale.Status)
+				}
+			})
+		}
+	}
+}
+
+func TestServeFeedChangesETag(t *testing.T) {
+	server, store := newTestFeedServer(t)
+	resp, _ := get(t, server.URL+"/users/ann/timeline.rss", nil)
+	etag := resp.Header.Get("ETag")
+	store.posts[0].Title = "Edited"
+	resp, _ = get(t, server.URL+"/users/ann/timeline.rss", http.Header{"If-None-Match": {etag}})
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == etag {
+		t.Errorf("after an edit, status = %s and ETag = %s, want 200 and a new ETag", resp.Status, resp.Header.Get("ETag"))
+	}
+}
+
+func TestServeFeedNotFound(t *testing.T) {
+	server, _ := newTestFeedServer(t)
+	for _, path := range []string{
+		"/users/bob/timeline.rss",
+		"/users/ann/timeline.xml",
+		"/users/ann/inbox.rss",
+		"/users/ann/tags/rust.rss",
+		"/users/ann/tags/golang",
+	} {
+		if resp, _ := get(t, server.URL+path, nil); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET %s = %s, want 404", path, resp.Status)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+-- +goose Up
+ALTER TABLE posts
+ADD COLUMN content TEXT,
+ADD COLUMN content_hash TEXT;
+
+CREATE TABLE post_revisions (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    title TEXT NOT NULL,
+    description TEXT,
+    content TEXT,
+    content_hash TEXT NOT NULL
+);
+
+CREATE INDEX post_revisions_post_id_idx ON post_revisions (post_id, created_at);
+
+-- +goose Down
+DROP TABLE post_revisions;
+
+ALTER TABLE posts
+DROP COLUMN content_hash,
+DROP COLUMN content;
@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE fetch_log (
+    id UUID PRIMARY KEY,
+    feed_id UUID NOT NULL REFERENCES feeds(id) ON DELETE CASCADE,
+    started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    duration_ms BIGINT NOT NULL,
+    http_status INTEGER,
+    bytes BIGINT NOT NULL,
+    items_seen INTEGER NOT NULL,
+    posts_new INTEGER NOT NULL,
+    posts_updated INTEGER NOT NULL,
+    error TEXT
+);
+
+CREATE INDEX fetch_log_feed_id_started_at_idx ON fetch_log (feed_id, started_at DESC);
+
+-- +goose Down
+DROP TABLE fetch_log;
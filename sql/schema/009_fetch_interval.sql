@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE feeds
+ADD COLUMN fetch_interval_seconds INTEGER;
+
+-- +goose Down
+ALTER TABLE feeds
+DROP COLUMN fetch_interval_seconds;
@@ -0,0 +1,19 @@
+-- +goose Up
+ALTER TABLE posts
+ADD COLUMN short_id BIGINT GENERATED ALWAYS AS IDENTITY;
+
+ALTER TABLE posts
+ADD CONSTRAINT posts_short_id_key UNIQUE (short_id);
+
+CREATE TABLE post_stars (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (user_id, post_id)
+);
+
+-- +goose Down
+DROP TABLE post_stars;
+
+ALTER TABLE posts
+DROP COLUMN short_id;
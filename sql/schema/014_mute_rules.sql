@@ -0,0 +1,46 @@
+-- +goose Up
+ALTER TABLE posts
+ADD COLUMN author TEXT,
+ADD COLUMN categories TEXT[] NOT NULL DEFAULT '{}';
+
+CREATE TABLE mute_rules (
+    id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    feed_id UUID REFERENCES feeds(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('keyword', 'regex', 'author', 'category')),
+    pattern TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX mute_rules_user_id_idx ON mute_rules (user_id);
+
+-- post_muted reports whether any of a user's mute rules hides a post. Rules
+-- without a feed apply to every feed.
+-- +goose StatementBegin
+CREATE FUNCTION post_muted(muting_user UUID, post posts) RETURNS BOOLEAN
+LANGUAGE sql STABLE AS $$
+    SELECT EXISTS (
+        SELECT 1 FROM mute_rules
+        WHERE mute_rules.user_id = muting_user
+          AND (mute_rules.feed_id IS NULL OR mute_rules.feed_id = post.feed_id)
+          AND CASE mute_rules.kind
+              WHEN 'keyword' THEN strpos(lower(post.title), lower(mute_rules.pattern)) > 0
+                  OR strpos(lower(coalesce(post.description, '')), lower(mute_rules.pattern)) > 0
+              WHEN 'regex' THEN post.title ~* mute_rules.pattern
+                  OR coalesce(post.description, '') ~* mute_rules.pattern
+              WHEN 'author' THEN lower(post.author) = lower(mute_rules.pattern)
+              WHEN 'category' THEN lower(mute_rules.pattern) IN (SELECT lower(category) FROM unnest(post.categories) AS category)
+              ELSE false
+          END
+    )
+$$;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP FUNCTION post_muted(UUID, posts);
+
+DROP TABLE mute_rules;
+
+ALTER TABLE posts
+DROP COLUMN categories,
+DROP COLUMN author;
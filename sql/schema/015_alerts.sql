@@ -0,0 +1,24 @@
+-- +goose Up
+CREATE TABLE alert_rules (
+    id BIGINT GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    feed_id UUID REFERENCES feeds(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('keyword', 'regex')),
+    pattern TEXT NOT NULL,
+    command TEXT,
+    webhook_url TEXT,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    CHECK (command IS NOT NULL OR webhook_url IS NOT NULL)
+);
+
+CREATE TABLE alert_deliveries (
+    rule_id BIGINT NOT NULL REFERENCES alert_rules(id) ON DELETE CASCADE,
+    post_id UUID NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+    delivered_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    error TEXT,
+    PRIMARY KEY (rule_id, post_id)
+);
+
+-- +goose Down
+DROP TABLE alert_deliveries;
+DROP TABLE alert_rules;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN email TEXT,
+ADD COLUMN last_digest_at TIMESTAMP WITH TIME ZONE;
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN last_digest_at,
+DROP COLUMN email;
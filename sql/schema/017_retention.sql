@@ -0,0 +1,23 @@
+-- +goose Up
+ALTER TABLE feeds
+ADD COLUMN retention_max_age_seconds INTEGER,
+ADD COLUMN retention_max_posts INTEGER;
+
+-- Links of pruned posts, so fetching the feed again does not bring them back.
+-- last_seen_at is the last time the feed still listed the link.
+CREATE TABLE pruned_posts (
+    feed_id UUID NOT NULL REFERENCES feeds(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    pruned_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    last_seen_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    PRIMARY KEY (feed_id, url)
+);
+
+CREATE INDEX posts_feed_id_published_at_idx ON posts (feed_id, published_at DESC);
+
+-- +goose Down
+DROP INDEX posts_feed_id_published_at_idx;
+DROP TABLE pruned_posts;
+ALTER TABLE feeds
+DROP COLUMN retention_max_posts,
+DROP COLUMN retention_max_age_seconds;
@@ -0,0 +1,490 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/tbirddv/gator/internal/database"
+)
+
+// newPostsChannel is the Postgres notification channel NotifyNewPosts sends
+// on whenever a scrape inserts or updates posts.
+const newPostsChannel = "gator_new_posts"
+
+// tuiPostLimit caps how many posts the post pane loads at once.
+const tuiPostLimit = 500
+
+const tuiHelp = "tab: switch pane  j/k: move  enter: read  o: open in browser  m: toggle read  s: toggle star  a: unread/all  r: reload  q: quit"
+
+type pane int
+
+const (
+	feedPane pane = iota
+	postPane
+	readerPane
+)
+
+type tui struct {
+	s          *state
+	user       database.User
+	feeds      []database.GetFeedFollowsForUserRow
+	posts      []database.ListPostsRow
+	feedIndex  int // 0 is "All feeds", otherwise feeds[feedIndex-1]
+	postIndex  int
+	focus      pane
+	unreadOnly bool
+	reading    *database.Post
+	scroll     int
+	status     string
+	width      int
+	height     int
+}
+
+func HandleTUI(s *state) error {
+	if s.output != outputText {
+		return errors.New("tui is interactive and does not support --output")
+	}
+	user, err := getLoggedInUser(s)
+	if err != nil {
+		return fmt.Errorf("failed to get current user: %w", err)
+	}
+	ui := &tui{s: s, user: user, unreadOnly: true}
+	if err := ui.reload(); err != nil {
+		return err
+	}
+
+	restore, err := enterRawMode()
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	// Scrapes by any aggregator notify us, so new posts show up without polling
+	listener := pq.NewListener(s.config.DBURL, time.Second, time.Minute, nil)
+	defer listener.Close()
+	if err := listener.Listen(newPostsChannel); err != nil {
+		ui.status = "live refresh unavailable: " + err.Error()
+	}
+
+	keys := readKeys()
+	resize := make(chan os.Signal, 1)
+	notifyResize(resize)
+	defer signal.Stop(resize)
+	ui.width, ui.height = terminalSize()
+	ui.draw()
+	for {
+		select {
+		case key, ok := <-keys:
+			if !ok || ui.handleKey(key) {
+				return nil
+			}
+		case <-listener.Notify:
+			if err := ui.reload(); err != nil {
+				ui.status = err.Error()
+			} else {
+				ui.status = "new posts at " + time.Now().Format(time.Kitchen)
+			}
+		case <-resize:
+			ui.width, ui.height = terminalSize()
+		}
+		ui.draw()
+	}
+}
+
+// reload refreshes the feed list and the posts of the selected feed, keeping
+// the selected post when it is still listed.
+func (ui *tui) reload() error {
+	feeds, err := ui.s.queries.GetFeedFollowsForUser(context.Background(), ui.user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get followed feeds: %w", err)
+	}
+	ui.feeds = feeds
+	ui.feedIndex = min(ui.feedIndex, len(feeds))
+	return ui.loadPosts()
+}
+
+func (ui *tui) loadPosts() error {
+	var selected uuid.UUID
+	if ui.postIndex < len(ui.posts) {
+		selected = ui.posts[ui.postIndex].ID
+	}
+	filter := database.PostFilter{
+		UserID:     ui.user.ID,
+		UnreadOnly: ui.unreadOnly,
+		Limit:      tuiPostLimit,
+	}
+	if ui.feedIndex > 0 {
+		filter.FeedIDs = []uuid.UUID{ui.feeds[ui.feedIndex-1].FeedID}
+	}
+	posts, err := ui.s.queries.ListPosts(context.Background(), filter)
+	if err != nil {
+		return fmt.Errorf("failed to get posts: %w", err)
+	}
+	ui.posts = posts
+	ui.postIndex = 0
+	for i, post := range posts {
+		if post.ID == selected {
+			ui.postIndex = i
+		}
+	}
+	return nil
+}
+
+// handleKey applies a key press and reports whether the tui should exit.
+func (ui *tui) handleKey(key string) bool {
+	ui.status = ""
+	var err error
+	switch key {
+	case "q", "\x03":
+		return true
+	case "\t":
+		ui.focus = (ui.focus + 1) % 3
+	case "\x1b[Z":
+		ui.focus = (ui.focus + 2) % 3
+	case "j", "\x1b[B":
+		err = ui.move(1)
+	case "k", "\x1b[A":
+		err = ui.move(-1)
+	case " ", "\x1b[6~":
+		err = ui.move(ui.pageSize())
+	case "b", "\x1b[5~":
+		err = ui.move(-ui.pageSize())
+	case "\r", "\n":
+		switch ui.focus {
+		case feedPane:
+			ui.focus = postPane
+		case postPane:
+			err = ui.readSelected()
+		}
+	case "o":
+		err = ui.openSelected()
+	case "m":
+		err = ui.toggleRead()
+	case "s":
+		err = ui.toggleStar()
+	case "a":
+		ui.unreadOnly = !ui.unreadOnly
+		err = ui.loadPosts()
+	case "r":
+		err = ui.reload()
+	}
+	if err != nil {
+		ui.status = err.Error()
+	}
+	return false
+}
+
+func (ui *tui) move(delta int) error {
+	switch ui.focus {
+	case feedPane:
+		index := clamp(ui.feedIndex+delta, 0, len(ui.feeds))
+		if index == ui.feedIndex {
+			return nil
+		}
+		ui.feedIndex = index
+		ui.postIndex = 0
+		return ui.loadPosts()
+	case postPane:
+		ui.postIndex = clamp(ui.postIndex+delta, 0, len(ui.posts)-1)
+	case readerPane:
+		ui.scroll = max(ui.scroll+delta, 0)
+	}
+	return nil
+}
+
+// selected returns the highlighted post, if any.
+func (ui *tui) selected() (*database.ListPostsRow, error) {
+	if ui.postIndex >= len(ui.posts) {
+		return nil, errors.New("no post selected")
+	}
+	return &ui.posts[ui.postIndex], nil
+}
+
+func (ui *tui) readSelected() error {
+	row, err := ui.selected()
+	if err != nil {
+		return err
+	}
+	post, err := ui.s.queries.GetPostByShortID(context.Background(), row.ShortID)
+	if err != nil {
+		return fmt.Errorf("failed to get post: %w", err)
+	}
+	ui.reading = &post
+	ui.scroll = 0
+	ui.focus = readerPane
+	return ui.setRead(row, true)
+}
+
+func (ui *tui) openSelected() error {
+	row, err := ui.selected()
+	if err != nil {
+		return err
+	}
+	if err := openURL(row.Url); err != nil {
+		return err
+	}
+	ui.status = "opened " + row.Url
+	return ui.setRead(row, true)
+}
+
+func (ui *tui) toggleRead() error {
+	row, err := ui.selected()
+	if err != nil {
+		return err
+	}
+	return ui.setRead(row, !row.IsRead)
+}
+
+// setRead records the read state of a post. The post stays listed until the
+// next reload so it doesn't vanish from under the cursor.
+func (ui *tui) setRead(row *database.ListPostsRow, read bool) error {
+	if row.IsRead == read {
+		return nil
+	}
+	if read {
+		readParams := database.MarkPostReadParams{
+			UserID: ui.user.ID,
+			PostID: row.ID,
+			ReadAt: time.Now(),
+		}
+		if _, err := ui.s.queries.MarkPostRead(context.Background(), readParams); err != nil {
+			return fmt.Errorf("failed to mark post read: %w", err)
+		}
+	} else {
+		unreadParams := database.MarkPostUnreadParams{
+			UserID: ui.user.ID,
+			PostID: row.ID,
+		}
+		if _, err := ui.s.queries.MarkPostUnread(context.Background(), unreadParams); err != nil {
+			return fmt.Errorf("failed to mark post unread: %w", err)
+		}
+	}
+	row.IsRead = read
+	feeds, err := ui.s.queries.GetFeedFollowsForUser(context.Background(), ui.user.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get followed feeds: %w", err)
+	}
+	ui.feeds = feeds
+	return nil
+}
+
+func (ui *tui) toggleStar() error {
+	row, err := ui.selected()
+	if err != nil {
+		return err
+	}
+	if row.IsStarred {
+		unstarParams := database.UnstarPostParams{
+			UserID: ui.user.ID,
+			PostID: row.ID,
+		}
+		if _, err := ui.s.queries.UnstarPost(context.Background(), unstarParams); err != nil {
+			return fmt.Errorf("failed to unstar post: %w", err)
+		}
+	} else {
+		starParams := database.StarPostParams{
+			UserID:    ui.user.ID,
+			PostID:    row.ID,
+			CreatedAt: time.Now(),
+		}
+		if _, err := ui.s.queries.StarPost(context.Background(), starParams); err != nil {
+			return fmt.Errorf("failed to star post: %w", err)
+		}
+	}
+	row.IsStarred = !row.IsStarred
+	return nil
+}
+
+// layout splits the screen below the title bar and above the status bar into
+// the feed column on the left and the post list over the reader on the right.
+func (ui *tui) layout() (feedWidth, postHeight, readerHeight int) {
+	feedWidth = min(30, ui.width/4)
+	body := max(ui.height-2, 3)
+	postHeight = max(body/3, 1)
+	readerHeight = max(body-postHeight-1, 1)
+	return feedWidth, postHeight, readerHeight
+}
+
+func (ui *tui) pageSize() int {
+	_, postHeight, readerHeight := ui.layout()
+	if ui.focus == readerPane {
+		return max(readerHeight-1, 1)
+	}
+	return max(postHeight-1, 1)
+}
+
+func (ui *tui) draw() {
+	feedWidth, postHeight, readerHeight := ui.layout()
+	rightWidth := max(ui.width-feedWidth-1, 1)
+
+	var unread int64
+	for _, feed := range ui.feeds {
+		unread += feed.UnreadCount
+	}
+	feedLines := []string{fmt.Sprintf("All feeds (%d)", unread)}
+	for _, feed := range ui.feeds {
+		feedLines = append(feedLines, fmt.Sprintf("%s (%d)", plainLine(feed.FeedName), feed.UnreadCount))
+	}
+	left := ui.list(feedLines, ui.feedIndex, postHeight+1+readerHeight, feedWidth, ui.focus == feedPane)
+
+	var postLines []string
+	for _, post := range ui.posts {
+		marker, star := "●", " "
+		if post.IsRead {
+			marker = " "
+		}
+		if post.IsStarred {
+			star = "★"
+		}
+		postLines = append(postLines, fmt.Sprintf("%s%s %s  %s", marker, star, post.PublishedAt.Format(time.DateOnly), plainLine(post.Title)))
+	}
+	if len(postLines) == 0 {
+		postLines = []string{"  no posts"}
+	}
+	right := ui.list(postLines, ui.postIndex, postHeight, rightWidth, ui.focus == postPane)
+	right = append(right, fit(strings.Repeat("─", rightWidth), rightWidth))
+	right = append(right, ui.reader(readerHeight, rightWidth)...)
+
+	mode := "unread"
+	if !ui.unreadOnly {
+		mode = "all"
+	}
+	status := ui.status
+	if status == "" {
+		status = tuiHelp
+	}
+
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	b.WriteString("\x1b[7m" + fit(fmt.Sprintf(" gator: %s (%s posts)", ui.user.Name, mode), ui.width) + "\x1b[0m\r\n")
+	for i := range left {
+		b.WriteString(left[i] + "│" + right[i] + "\r\n")
+	}
+	b.WriteString("\x1b[2m" + fit(status, ui.width) + "\x1b[0m")
+	os.Stdout.WriteString(b.String())
+}
+
+// list renders lines into a pane of the given size, scrolled so the selected
+// line is visible and highlighted when the pane has focus.
+func (ui *tui) list(lines []string, selected, height, width int, focused bool) []string {
+	start := clamp(selected-height/2, 0, max(len(lines)-height, 0))
+	out := make([]string, 0, height)
+	for i := start; i < start+height; i++ {
+		if i >= len(lines) {
+			out = append(out, fit("", width))
+			continue
+		}
+		line := fit(lines[i], width)
+		if i == selected {
+			if focused {
+				line = "\x1b[7m" + line + "\x1b[0m"
+			} else {
+				line = "\x1b[1m" + line + "\x1b[0m"
+			}
+		}
+		out = append(out, line)
+	}
+	return out
+}
+
+// reader renders the open post as wrapped plain text.
+func (ui *tui) reader(height, width int) []string {
+	var lines []string
+	if ui.reading == nil {
+		lines = []string{"Press enter on a post to read it here."}
+	} else {
+		lines = wrapText(renderPost(*ui.reading), width-1)
+	}
+	ui.scroll = min(ui.scroll, max(len(lines)-height, 0))
+
+	out := make([]string, 0, height)
+	for i := ui.scroll; i < ui.scroll+height; i++ {
+		line := ""
+		if i < len(lines) {
+			line = " " + lines[i]
+		}
+		out = append(out, fit(line, width))
+	}
+	return out
+}
+
+// fit truncates or pads s to exactly width runes.
+func fit(s string, width int) string {
+	if n := utf8.RuneCountInString(s); n <= width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	runes := []rune(s)
+	if width < 1 {
+		return ""
+	}
+	return string(runes[:width-1]) + "…"
+}
+
+func clamp(v, lo, hi int) int {
+	return max(lo, min(v, hi))
+}
+
+// enterRawMode switches the terminal to unbuffered input on the alternate
+// screen and returns a function restoring it.
+func enterRawMode() (func(), error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, fmt.Errorf("tui needs an interactive terminal: %w", err)
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, fmt.Errorf("failed to set terminal mode: %w", err)
+	}
+	os.Stdout.WriteString("\x1b[?1049h\x1b[?25l\x1b[2J")
+	return func() {
+		os.Stdout.WriteString("\x1b[?25h\x1b[?1049l")
+		stty(strings.TrimSpace(saved))
+	}, nil
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+// terminalSize returns the terminal's columns and rows, assuming 80x24 when
+// it can't be determined.
+func terminalSize() (width, height int) {
+	out, err := stty("size")
+	if err != nil {
+		return 80, 24
+	}
+	var rows, cols int
+	if _, err := fmt.Sscan(out, &rows, &cols); err != nil || rows == 0 || cols == 0 {
+		return 80, 24
+	}
+	return cols, rows
+}
+
+// readKeys delivers key presses from stdin, one escape sequence at a time.
+func readKeys() <-chan string {
+	keys := make(chan string)
+	go func() {
+		defer close(keys)
+		buf := make([]byte, 16)
+		for {
+			n, err := os.Stdin.Read(buf)
+			if err != nil {
+				return
+			}
+			keys <- string(buf[:n])
+		}
+	}()
+	return keys
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// notifyResize does nothing where there is no SIGWINCH; the tui keeps the
+// size it started with.
+func notifyResize(c chan<- os.Signal) {}
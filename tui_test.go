@@ -0,0 +1,150 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/tbirddv/gator/internal/database"
+)
+
+func TestFit(t *testing.T) {
+	tests := []struct {
+		name  string
+		s     string
+		width int
+		want  string
+	}{
+		{"pads", "abc", 5, "abc  "},
+		{"exact", "abc", 3, "abc"},
+		{"truncates", "abcdef", 4, "abc…"},
+		{"counts runes", "héllo", 3, "hé…"},
+		{"empty", "", 2, "  "},
+		{"no width", "abc", 0, ""},
+		{"negative width", "abc", -1, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := fit(tt.s, tt.width); got != tt.want {
+				t.Errorf("fit(%q, %d) = %q, want %q", tt.s, tt.width, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLayout(t *testing.T) {
+	tests := []struct {
+		name                                string
+		width, height                       int
+		feedWidth, postHeight, readerHeight int
+	}{
+		{"default terminal", 80, 24, 20, 7, 14},
+		{"wide terminal", 200, 50, 30, 16, 31},
+		{"tiny terminal", 10, 3, 2, 1, 1},
+		{"unknown size", 0, 0, 0, 1, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ui := &tui{width: tt.width, height: tt.height}
+			feedWidth, postHeight, readerHeight := ui.layout()
+			if feedWidth != tt.feedWidth || postHeight != tt.postHeight || readerHeight != tt.readerHeight {
+				t.Errorf("layout() = %d, %d, %d, want %d, %d, %d",
+					feedWidth, postHeight, readerHeight, tt.feedWidth, tt.postHeight, tt.readerHeight)
+			}
+		})
+	}
+}
+
+func TestHandleKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		focus      pane
+		postIndex  int
+		scroll     int
+		key        string
+		exit       bool
+		wantFocus  pane
+		wantIndex  int
+		wantScroll int
+		wantStatus string
+	}{
+		{name: "quit", key: "q", exit: true},
+		{name: "ctrl-c", key: "\x03", exit: true},
+		{name: "tab", focus: feedPane, key: "\t", wantFocus: postPane},
+		{name: "tab wraps", focus: readerPane, key: "\t", wantFocus: feedPane},
+		{name: "shift-tab wraps", focus: feedPane, key: "\x1b[Z", wantFocus: readerPane},
+		{name: "enter on feeds", focus: feedPane, key: "\r", wantFocus: postPane},
+		{name: "down", focus: postPane, key: "j", wantFocus: postPane, wantIndex: 1},
+		{name: "down arrow", focus: postPane, key: "\x1b[B", wantFocus: postPane, wantIndex: 1},
+		{name: "down at end", focus: postPane, postIndex: 9, key: "j", wantFocus: postPane, wantIndex: 9},
+		{name: "up at start", focus: postPane, key: "k", wantFocus: postPane},
+		{name: "page down", focus: postPane, key: " ", wantFocus: postPane, wantIndex: 6},
+		{name: "page up", focus: postPane, postIndex: 8, key: "\x1b[5~", wantFocus: postPane, wantIndex: 2},
+		{name: "scroll reader", focus: readerPane, key: "j", wantFocus: readerPane, wantScroll: 1},
+		{name: "page reader", focus: readerPane, scroll: 2, key: "b", wantFocus: readerPane},
+		{name: "unknown key", focus: postPane, postIndex: 3, key: "x", wantFocus: postPane, wantIndex: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ui := &tui{
+				posts:     make([]database.ListPostsRow, 10),
+				focus:     tt.focus,
+				postIndex: tt.postIndex,
+				scroll:    tt.scroll,
+				status:    "stale",
+				width:     80,
+				height:    24,
+			}
+			if exit := ui.handleKey(tt.key); exit != tt.exit {
+				t.Fatalf("handleKey(%q) = %v, want %v", tt.key, exit, tt.exit)
+			}
+			if tt.exit {
+				return
+			}
+			if ui.focus != tt.wantFocus || ui.postIndex != tt.wantIndex || ui.scroll != tt.wantScroll {
+				t.Errorf("handleKey(%q) left focus %d, post %d, scroll %d, want %d, %d, %d",
+					tt.key, ui.focus, ui.postIndex, ui.scroll, tt.wantFocus, tt.wantIndex, tt.wantScroll)
+			}
+			if ui.status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", ui.status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestHandleKeyWithoutPosts(t *testing.T) {
+	ui := &tui{focus: postPane, width: 80, height: 24}
+	for _, key := range []string{"m", "s", "o", "\r"} {
+		ui.handleKey(key)
+		if ui.status != "no post selected" {
+			t.Errorf("handleKey(%q) set status %q, want no post selected", key, ui.status)
+		}
+	}
+}
+
+func TestPlainLine(t *testing.T) {
+	tests := []struct {
+		name  string
+		title string
+		want  string
+	}{
+		{"plain", "Go 1.24 is released", "Go 1.24 is released"},
+		{"escape sequence", "Breaking\x1b[2J news", "Breaking[2J news"},
+		{"terminal title", "\x1b]0;pwned\x07Post", "]0;pwnedPost"},
+		{"line breaks", "One\r\nTwo\tThree", "One Two Three"},
+		{"surrounding space", "  padded  ", "padded"},
+		{"keeps angle brackets", "Why <T> matters", "Why <T> matters"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := plainLine(tt.title); got != tt.want {
+				t.Errorf("plainLine(%q) = %q, want %q", tt.title, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlainTextDropsControlCharacters(t *testing.T) {
+	got := plainText("<p>one\x1b[31m</p><p>two\x00</p>")
+	if want := "one[31m\n\ntwo"; got != want {
+		t.Errorf("plainText = %q, want %q", got, want)
+	}
+}
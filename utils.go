@@ -3,15 +3,27 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
 	"errors"
+	"flag"
 	"fmt"
+	"html"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/lib/pq"
 
 	"github.com/tbirddv/gator/internal/database"
-	"github.com/tbirddv/gator/internal/rssfeed"
+	"github.com/tbirddv/gator/internal/urlnorm"
 )
 
 func getLoggedInUser(s *state) (database.User, error) {
@@ -25,6 +37,36 @@ func getLoggedInUser(s *state) (database.User, error) {
 	return user, nil
 }
 
+// touchCurrentUser records that the logged-in user just used gator. Feeds
+// followed by active users are fetched more often.
+func touchCurrentUser(s *state) {
+	if s.config.CurrentUserName == "" {
+		return
+	}
+	touchParams := database.TouchUserParams{
+		LastActiveAt: NewNullTime(time.Now()),
+		Name:         s.config.CurrentUserName,
+	}
+	if err := s.queries.TouchUser(context.Background(), touchParams); err != nil {
+		s.logger.Warn("failed to record user activity", "user", s.config.CurrentUserName, "error", err)
+	}
+}
+
+// checkRegex makes sure Postgres, which runs regex rules, can compile
+// pattern. Go's regexp syntax differs, so a pattern it accepts could still
+// make every query that applies the rule fail.
+func checkRegex(s *state, pattern string) error {
+	_, err := s.queries.CheckRegex(context.Background(), pattern)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "2201B" {
+		return fmt.Errorf("invalid regex: %s", pqErr.Message)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check regex: %w", err)
+	}
+	return nil
+}
+
 func NewNullTime(t time.Time) sql.NullTime {
 	return sql.NullTime{
 		Time:  t,
@@ -40,6 +82,7 @@ func parseFlexibleTimestamp(timestampStr string) (time.Time, error) {
 		"2006-01-02 15:04:05-07:00", // PostgreSQL format
 		"2006-01-02 15:04:05",       // Without timezone
 		"2006-01-02T15:04:05",       // ISO without timezone
+		time.DateOnly,               // "2006-01-02"
 	}
 
 	for _, format := range formats {
@@ -51,53 +94,363 @@ func parseFlexibleTimestamp(timestampStr string) (time.Time, error) {
 	return time.Time{}, fmt.Errorf("unable to parse timestamp: %s", timestampStr)
 }
 
-func scrapeFeeds(s *state) error {
-	feed, err := s.queries.GetNextFeedToFetch(context.Background())
+// parseAge parses a duration that may also be given in whole days or weeks,
+// such as "36h", "90d" or "2w".
+func parseAge(value string) (time.Duration, error) {
+	if n, unit := strings.TrimRight(value, "dw"), strings.TrimLeft(value, "0123456789"); unit == "d" || unit == "w" {
+		if count, err := strconv.Atoi(n); err == nil {
+			if unit == "w" {
+				count *= 7
+			}
+			return time.Duration(count) * 24 * time.Hour, nil
+		}
+	}
+	d, err := time.ParseDuration(value)
 	if err != nil {
-		return fmt.Errorf("failed to get next feed to fetch: %w", err)
+		return 0, fmt.Errorf("%s is not a duration like 36h, 90d or 2w", value)
 	}
+	return d, nil
+}
 
-	// Simulate feed scraping
-	fmt.Printf("Scraping feed: %s\n", feed.Url)
-
-	fetchedTime := database.MarkFeedFetchedParams{
-		LastFetchedAt: NewNullTime(time.Now()),
-		ID:            feed.ID,
+// parseTimeOrAgo parses an absolute timestamp or a duration before now such
+// as "36h", "7d" or "2w".
+func parseTimeOrAgo(value string, now time.Time) (time.Time, error) {
+	if d, err := parseAge(value); err == nil {
+		return now.Add(-d), nil
 	}
+	t, err := parseFlexibleTimestamp(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s is neither a date nor a duration like 7d", value)
+	}
+	return t, nil
+}
+
+// stringList is a flag that may be repeated, collecting every value.
+type stringList []string
 
-	if err := s.queries.MarkFeedFetched(context.Background(), fetchedTime); err != nil {
-		return fmt.Errorf("failed to mark feed as fetched: %w", err)
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// parseArgs parses flags from args, allowing them to appear before, after or
+// between positional arguments, and returns the positional arguments.
+// Everything after a "--" is positional.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	fs.SetOutput(io.Discard)
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		rest := fs.Args()
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, rest...), nil
+		}
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
 	}
+}
 
-	fetchedFeed, err := rssfeed.FetchRSSFeed(context.Background(), feed.Url)
+// resolveFeed looks up a feed by URL, falling back to its name.
+func resolveFeed(s *state, ref string) (database.Feed, error) {
+	feed, err := s.queries.GetFeedByURL(context.Background(), ref)
+	if err == nil {
+		return feed, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return database.Feed{}, fmt.Errorf("failed to get feed by URL: %w", err)
+	}
+	feeds, err := s.queries.GetFeedsByName(context.Background(), ref)
 	if err != nil {
-		return fmt.Errorf("failed to fetch RSS feed: %w", err)
+		return database.Feed{}, fmt.Errorf("failed to get feed by name: %w", err)
+	}
+	switch len(feeds) {
+	case 0:
+		return database.Feed{}, fmt.Errorf("no feed with URL or name %s", ref)
+	case 1:
+		return feeds[0], nil
+	default:
+		return database.Feed{}, fmt.Errorf("%d feeds are named %s, use the feed URL instead", len(feeds), ref)
 	}
+}
 
-	for _, item := range fetchedFeed.Channel.Items {
-		pubDate, err := parseFlexibleTimestamp(item.PubDate)
+// resolvePost looks up a post by the short ID shown in browse, falling back
+// to its URL. When several feeds carry the same URL the most recently updated
+// copy is used.
+func resolvePost(s *state, ref string) (database.Post, error) {
+	if shortID, err := strconv.ParseInt(strings.TrimPrefix(ref, "#"), 10, 64); err == nil {
+		post, err := s.queries.GetPostByShortID(context.Background(), shortID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return database.Post{}, fmt.Errorf("no post with ID %d", shortID)
+		}
 		if err != nil {
-			fmt.Printf("Skipping item with invalid pubDate: %s\n", item.PubDate)
+			return database.Post{}, fmt.Errorf("failed to get post by ID: %w", err)
+		}
+		return post, nil
+	}
+	posts, err := s.queries.GetPostsByURL(context.Background(), ref)
+	if err == nil && len(posts) == 0 {
+		if canonical := urlnorm.Canonicalize(ref); canonical != ref {
+			posts, err = s.queries.GetPostsByURL(context.Background(), canonical)
+		}
+	}
+	if err != nil {
+		return database.Post{}, fmt.Errorf("failed to get post by URL: %w", err)
+	}
+	if len(posts) == 0 {
+		return database.Post{}, fmt.Errorf("no post with ID or URL %s", ref)
+	}
+	return posts[0], nil
+}
+
+// normalizeTags lowercases tag names and rejects ones that could not be
+// typed back as a single argument.
+func normalizeTags(names []string) ([]string, error) {
+	tags := make([]string, 0, len(names))
+	for _, name := range names {
+		tag := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "#")))
+		if tag == "" || strings.ContainsFunc(tag, unicode.IsSpace) || strings.Contains(tag, ",") {
+			return nil, fmt.Errorf("invalid tag %q: tags are single words without commas", name)
+		}
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
+
+// encodeCursor turns a post's position into an opaque token for browse.
+func encodeCursor(publishedAt time.Time, id uuid.UUID) string {
+	raw := strconv.FormatInt(publishedAt.UnixNano(), 10) + "_" + id.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(token string) (*database.PostCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor %s", token)
+	}
+	nanos, id, ok := strings.Cut(string(raw), "_")
+	if !ok {
+		return nil, fmt.Errorf("invalid cursor %s", token)
+	}
+	unixNano, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor %s", token)
+	}
+	postID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor %s", token)
+	}
+	return &database.PostCursor{PublishedAt: time.Unix(0, unixNano), ID: postID}, nil
+}
+
+// diffLines returns a line-by-line diff of old and new, prefixing removed
+// lines with "- ", added lines with "+ " and unchanged lines with "  ".
+func diffLines(old, new string) []string {
+	a := strings.Split(old, "\n")
+	b := strings.Split(new, "\n")
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var lines []string
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, "  "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, "- "+a[i])
+			i++
+		default:
+			lines = append(lines, "+ "+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, "- "+a[i])
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, "+ "+b[j])
+	}
+	return lines
+}
+
+// plainText renders an HTML fragment from a feed as plain text, keeping
+// paragraph and line breaks. Control characters are dropped so a feed can't
+// send escape sequences to the terminal.
+func plainText(fragment string) string {
+	var b strings.Builder
+	for len(fragment) > 0 {
+		start := strings.IndexByte(fragment, '<')
+		if start < 0 {
+			b.WriteString(fragment)
+			break
+		}
+		b.WriteString(fragment[:start])
+		end := strings.IndexByte(fragment[start:], '>')
+		if end < 0 || !isTagStart(fragment[start+1:]) {
+			// A literal "<" in text rather than the start of a tag
+			b.WriteByte('<')
+			fragment = fragment[start+1:]
 			continue
 		}
-		postParams := database.CreatePostParams{
-			ID:          uuid.New(),
-			CreatedAt:   time.Now(),
-			UpdatedAt:   time.Now(),
-			Title:       item.Title,
-			Url:         item.Link,
-			Description: sql.NullString{String: item.Description, Valid: item.Description != ""},
-			PublishedAt: pubDate,
-			FeedID:      feed.ID,
-		}
-		err = s.queries.CreatePost(context.Background(), postParams)
-		if err != nil {
-			if err, ok := err.(*pq.Error); ok && err.Code == "23505" {
-				continue // Skip duplicate posts
+		tag := strings.ToLower(strings.Trim(fragment[start+1:start+end], "/ "))
+		if name, _, _ := strings.Cut(tag, " "); blockTags[name] {
+			b.WriteString("\n")
+		}
+		fragment = fragment[start+end+1:]
+	}
+
+	var paragraphs []string
+	for _, paragraph := range strings.Split(html.UnescapeString(b.String()), "\n") {
+		paragraph = strings.Map(dropControl, paragraph)
+		if text := strings.Join(strings.Fields(paragraph), " "); text != "" {
+			paragraphs = append(paragraphs, text)
+		}
+	}
+	return strings.Join(paragraphs, "\n\n")
+}
+
+// plainLine normalizes feed text such as a title the way plainText does,
+// without dropping tags, and joins it onto a single line.
+func plainLine(text string) string {
+	return strings.Join(strings.Fields(strings.Map(dropControl, text)), " ")
+}
+
+// dropControl maps control characters other than whitespace to nothing, for
+// use with strings.Map.
+func dropControl(r rune) rune {
+	if unicode.IsControl(r) && !unicode.IsSpace(r) {
+		return -1
+	}
+	return r
+}
+
+func isTagStart(s string) bool {
+	if s == "" {
+		return false
+	}
+	c := s[0]
+	return c == '/' || c == '!' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// blockTags are the HTML elements that start a new paragraph in plainText.
+var blockTags = map[string]bool{
+	"p": true, "br": true, "div": true, "li": true, "tr": true, "blockquote": true, "pre": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+}
+
+// wrapText breaks text into lines of at most width runes, splitting on spaces
+// where possible.
+func wrapText(text string, width int) []string {
+	if width < 1 {
+		width = 1
+	}
+	var lines []string
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := ""
+		for _, word := range strings.Fields(paragraph) {
+			for utf8.RuneCountInString(word) > width {
+				if line != "" {
+					lines = append(lines, line)
+					line = ""
+				}
+				cut := []rune(word)
+				lines = append(lines, string(cut[:width]))
+				word = string(cut[width:])
+			}
+			switch {
+			case line == "":
+				line = word
+			case utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) <= width:
+				line += " " + word
+			default:
+				lines = append(lines, line)
+				line = word
 			}
-			fmt.Printf("Error creating post: %v\n", err)
 		}
+		lines = append(lines, line)
 	}
+	return lines
+}
 
+// openURL opens link in $BROWSER, or the platform's default browser.
+func openURL(link string) error {
+	var cmd *exec.Cmd
+	switch browser := os.Getenv("BROWSER"); {
+	case browser != "":
+		cmd = exec.Command(browser, link)
+	case runtime.GOOS == "darwin":
+		cmd = exec.Command("open", link)
+	case runtime.GOOS == "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", link)
+	default:
+		cmd = exec.Command("xdg-open", link)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to open browser: %w", err)
+	}
+	// Reap the launcher in the background; browsers usually detach anyway
+	go cmd.Wait()
+	return nil
+}
+
+// renderPost formats a post for reading as plain text, preferring its full
+// content over the description.
+func renderPost(post database.Post) string {
+	body := post.Content.String
+	if body == "" {
+		body = post.Description.String
+	}
+	header := fmt.Sprintf("%s\n#%d  %s\n%s", plainLine(post.Title), post.ShortID, post.PublishedAt.Format(time.RFC1123), strings.Map(dropControl, post.Url))
+	return header + "\n\n" + plainText(body)
+}
+
+// page shows text through $PAGER (less by default) when stdout is a
+// terminal, and prints it otherwise.
+func page(text string) error {
+	if info, err := os.Stdout.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		_, err := fmt.Println(text)
+		return err
+	}
+	pager := strings.Fields(os.Getenv("PAGER"))
+	if len(pager) == 0 {
+		pager = []string{"less"}
+	}
+	cmd := exec.Command(pager[0], pager[1:]...)
+	cmd.Stdin = strings.NewReader(text + "\n")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			_, err := fmt.Println(text)
+			return err
+		}
+		return fmt.Errorf("failed to run pager %s: %w", pager[0], err)
+	}
 	return nil
 }